@@ -0,0 +1,37 @@
+package goid
+
+import (
+	"runtime"
+	"sync"
+)
+
+var goroutinePrefix = []byte("goroutine ")
+
+// runtime.Stack 的缓冲会逃逸到堆上, 复用以避免每次调用分配
+var stackBufPool = sync.Pool{
+	New: func() interface{} {
+		return new([64]byte)
+	},
+}
+
+// 获取当前协程ID
+// runtime.Stack 首行格式: "goroutine 18 [running]:"
+func Get() int64 {
+	buf := stackBufPool.Get().(*[64]byte)
+	defer stackBufPool.Put(buf)
+	n := runtime.Stack(buf[:], false)
+	b := buf[:n]
+	if len(b) <= len(goroutinePrefix) {
+		return 0
+	}
+	b = b[len(goroutinePrefix):]
+
+	var id int64
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			break
+		}
+		id = id*10 + int64(c-'0')
+	}
+	return id
+}
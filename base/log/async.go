@@ -0,0 +1,172 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	asyncBufferSize    = 4 * 1024 * 1024
+	maxPendingBuffers  = 25
+	keptPendingBuffers = 2
+)
+
+var errAsyncClosed = errors.New("log: async sink closed")
+
+// 异步双缓冲输出, 参考 muduo AsyncLogging
+// 前端 Write 只把日志追加到内存缓冲 cur, 写满后换上备用缓冲 next;
+// 后台协程在缓冲写满或每隔 flushInterval 把已写满的缓冲整体交换出来写入下游 sink,
+// 前端不会因磁盘 IO 阻塞. 后台来不及写、积压超过 maxPendingBuffers 时丢弃多余的缓冲.
+type Async struct {
+	sink          Sink
+	flushInterval time.Duration
+
+	mu      sync.Mutex
+	cur     []byte
+	next    []byte
+	buffers [][]byte // 已写满, 待后台写入
+	closed  bool
+
+	wake      chan struct{}
+	flushReq  chan chan struct{}
+	quit      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewAsync(sink Sink, flushInterval time.Duration) *Async {
+	if flushInterval <= 0 {
+		flushInterval = 3 * time.Second
+	}
+	a := &Async{
+		sink:          sink,
+		flushInterval: flushInterval,
+		cur:           make([]byte, 0, asyncBufferSize),
+		next:          make([]byte, 0, asyncBufferSize),
+		wake:          make(chan struct{}, 1),
+		flushReq:      make(chan chan struct{}),
+		quit:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+func (a *Async) Write(p []byte) (int, error) {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return 0, errAsyncClosed
+	}
+	if len(a.cur)+len(p) > cap(a.cur) && len(a.cur) > 0 {
+		a.buffers = append(a.buffers, a.cur)
+		if a.next != nil {
+			a.cur, a.next = a.next, nil
+		} else {
+			a.cur = make([]byte, 0, asyncBufferSize)
+		}
+		select {
+		case a.wake <- struct{}{}:
+		default:
+		}
+	}
+	a.cur = append(a.cur, p...)
+	a.mu.Unlock()
+	return len(p), nil
+}
+
+// 等待后台把当前已写入的日志全部写入下游并 Flush
+func (a *Async) Flush() error {
+	ch := make(chan struct{})
+	select {
+	case a.flushReq <- ch:
+		<-ch
+	case <-a.done:
+	}
+	return nil
+}
+
+// 写完剩余日志后停止后台协程, 并关闭下游 sink
+func (a *Async) Close() error {
+	var err error
+	a.closeOnce.Do(func() {
+		a.mu.Lock()
+		a.closed = true
+		a.mu.Unlock()
+		close(a.quit)
+		<-a.done
+		err = a.sink.Close()
+	})
+	return err
+}
+
+func (a *Async) run() {
+	defer close(a.done)
+
+	ticker := time.NewTicker(a.flushInterval)
+	defer ticker.Stop()
+
+	spare1 := make([]byte, 0, asyncBufferSize)
+	spare2 := make([]byte, 0, asyncBufferSize)
+	var toWrite [][]byte
+
+	for {
+		var flushed chan struct{}
+		quit := false
+		select {
+		case <-a.wake:
+		case <-ticker.C:
+		case flushed = <-a.flushReq:
+		case <-a.quit:
+			quit = true
+		}
+
+		a.mu.Lock()
+		a.buffers = append(a.buffers, a.cur)
+		a.cur, spare1 = spare1, nil
+		toWrite, a.buffers = a.buffers, toWrite[:0]
+		if a.next == nil {
+			a.next, spare2 = spare2, nil
+		}
+		a.mu.Unlock()
+
+		if len(toWrite) > maxPendingBuffers {
+			msg := fmt.Sprintf("%s Dropped log messages, %d larger buffers\n",
+				time.Now().Format(timeLayout), len(toWrite)-keptPendingBuffers)
+			_, _ = a.sink.Write([]byte(msg))
+			toWrite = toWrite[:keptPendingBuffers]
+		}
+		for _, b := range toWrite {
+			if len(b) > 0 {
+				_, _ = a.sink.Write(b)
+			}
+		}
+		_ = a.sink.Flush()
+
+		// 回收缓冲, 避免反复分配
+		for i, b := range toWrite {
+			if spare1 == nil {
+				spare1 = b[:0]
+			} else if spare2 == nil {
+				spare2 = b[:0]
+			}
+			toWrite[i] = nil
+		}
+		toWrite = toWrite[:0]
+		if spare1 == nil {
+			spare1 = make([]byte, 0, asyncBufferSize)
+		}
+		if spare2 == nil {
+			spare2 = make([]byte, 0, asyncBufferSize)
+		}
+
+		if flushed != nil {
+			close(flushed)
+		}
+		if quit {
+			return
+		}
+	}
+}
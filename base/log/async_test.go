@@ -0,0 +1,96 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAsyncFlush(t *testing.T) {
+	sink := &memSink{}
+	a := NewAsync(sink, time.Hour)
+	defer a.Close()
+
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(a, "line %d\n", i)
+	}
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	var want strings.Builder
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(&want, "line %d\n", i)
+	}
+	if got := sink.String(); got != want.String() {
+		t.Fatalf("got %q, want %q", got, want.String())
+	}
+}
+
+func TestAsyncFlushInterval(t *testing.T) {
+	sink := &memSink{}
+	a := NewAsync(sink, 10*time.Millisecond)
+	defer a.Close()
+
+	_, _ = a.Write([]byte("tick\n"))
+	deadline := time.Now().Add(time.Second)
+	for sink.String() != "tick\n" {
+		if time.Now().After(deadline) {
+			t.Fatal("background goroutine did not flush")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// 多个协程并发写入超过单个缓冲大小的数据, 关闭后每条日志都完整且各协程内有序
+func TestAsyncConcurrentClose(t *testing.T) {
+	sink := &memSink{}
+	a := NewAsync(sink, time.Hour)
+
+	const (
+		writers = 8
+		lines   = 2500
+	)
+	padding := strings.Repeat("x", 256)
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < lines; i++ {
+				fmt.Fprintf(a, "%d %d %s\n", w, i, padding)
+			}
+		}(w)
+	}
+	wg.Wait()
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !sink.closed {
+		t.Fatal("Close did not close the underlying sink")
+	}
+	if _, err := a.Write([]byte("late\n")); err == nil {
+		t.Fatal("Write after Close should fail")
+	}
+
+	next := make([]int, writers)
+	out := strings.TrimSuffix(sink.String(), "\n")
+	for _, line := range strings.Split(out, "\n") {
+		var w, i int
+		var p string
+		if _, err := fmt.Sscanf(line, "%d %d %s", &w, &i, &p); err != nil || p != padding {
+			t.Fatalf("corrupted line %q", line)
+		}
+		if i != next[w] {
+			t.Fatalf("writer %d: got line %d, want %d", w, i, next[w])
+		}
+		next[w]++
+	}
+	for w, n := range next {
+		if n != lines {
+			t.Fatalf("writer %d: got %d lines, want %d", w, n, lines)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package log
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	fileBufferSize    = 64 * 1024
+	fileFlushInterval = 3 * time.Second
+)
+
+// 滚动日志文件, 参考 muduo LogFile
+// 文件名: basename.20060102-150405.000.hostname.pid.log
+// 写入字节数超过 rollSize, 或进入新的 rollInterval 周期时滚动到新文件; 0 表示不按该条件滚动
+type FileSink struct {
+	basename     string
+	rollSize     int64
+	rollInterval time.Duration
+
+	mu        sync.Mutex
+	file      *os.File
+	w         *bufio.Writer
+	name      string
+	written   int64
+	period    time.Time // 当前周期起点
+	lastFlush time.Time
+}
+
+func NewFileSink(basename string, rollSize int64, rollInterval time.Duration) (*FileSink, error) {
+	f := &FileSink{
+		basename:     basename,
+		rollSize:     rollSize,
+		rollInterval: rollInterval,
+	}
+	if err := f.roll(time.Now()); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *FileSink) fileName(now time.Time) string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknownhost"
+	}
+	return fmt.Sprintf("%s.%s.%s.%d.log", f.basename, now.Format("20060102-150405.000"), hostname, os.Getpid())
+}
+
+// 切换到新文件; 新文件名与当前相同(同一毫秒内再次滚动)时继续写当前文件
+func (f *FileSink) roll(now time.Time) error {
+	if f.rollInterval > 0 {
+		f.period = now.Truncate(f.rollInterval)
+	}
+	name := f.fileName(now)
+	if name == f.name {
+		return nil
+	}
+
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if f.file != nil {
+		_ = f.w.Flush()
+		_ = f.file.Close()
+	}
+	f.file = file
+	f.name = name
+	f.written = 0
+	f.lastFlush = now
+	if f.w == nil {
+		f.w = bufio.NewWriterSize(file, fileBufferSize)
+	} else {
+		f.w.Reset(file)
+	}
+	return nil
+}
+
+// 当前写入的文件名
+func (f *FileSink) Name() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.name
+}
+
+func (f *FileSink) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	now := time.Now()
+	if (f.rollSize > 0 && f.written >= f.rollSize) ||
+		(f.rollInterval > 0 && !now.Truncate(f.rollInterval).Equal(f.period)) {
+		if err := f.roll(now); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.w.Write(p)
+	f.written += int64(n)
+	if err == nil && now.Sub(f.lastFlush) >= fileFlushInterval {
+		f.lastFlush = now
+		err = f.w.Flush()
+	}
+	return n, err
+}
+
+func (f *FileSink) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	f.lastFlush = time.Now()
+	return f.w.Flush()
+}
+
+func (f *FileSink) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.w.Flush()
+	if cerr := f.file.Close(); err == nil {
+		err = cerr
+	}
+	f.file = nil
+	return err
+}
@@ -0,0 +1,89 @@
+package log
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readLogs(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "app.*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var contents []string
+	for _, name := range files {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents = append(contents, string(b))
+	}
+	return contents
+}
+
+func TestFileSinkRollSize(t *testing.T) {
+	dir := t.TempDir()
+	f, err := NewFileSink(filepath.Join(dir, "app"), 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := f.Name()
+	_, _ = f.Write([]byte("0123456789\n"))
+	time.Sleep(2 * time.Millisecond) // 文件名精确到毫秒
+	_, _ = f.Write([]byte("abc\n"))
+	if f.Name() == first {
+		t.Fatal("file was not rolled after exceeding rollSize")
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := strings.Join(readLogs(t, dir), "|")
+	if got != "0123456789\n|abc\n" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestFileSinkRollInterval(t *testing.T) {
+	dir := t.TempDir()
+	f, err := NewFileSink(filepath.Join(dir, "app"), 0, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	first := f.Name()
+	_, _ = f.Write([]byte("a\n"))
+	time.Sleep(40 * time.Millisecond)
+	_, _ = f.Write([]byte("b\n"))
+	if f.Name() == first {
+		t.Fatal("file was not rolled after rollInterval")
+	}
+	_ = f.Flush()
+	if n := len(readLogs(t, dir)); n != 2 {
+		t.Fatalf("got %d files, want 2", n)
+	}
+}
+
+func TestFileSinkAsync(t *testing.T) {
+	dir := t.TempDir()
+	f, err := NewFileSink(filepath.Join(dir, "app"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := New(NewAsync(f, time.Hour), InfoLevel)
+	l.Infof("async to file")
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	logs := readLogs(t, dir)
+	if len(logs) != 1 || !strings.Contains(logs[0], "async to file") {
+		t.Fatalf("got %q", logs)
+	}
+}
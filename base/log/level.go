@@ -0,0 +1,43 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 日志级别, 低于 Logger 级别的日志直接丢弃, 不做格式化
+type Level int32
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+	FatalLevel
+)
+
+// 定长, 便于对齐
+var levelNames = [...]string{
+	DebugLevel: "DEBUG",
+	InfoLevel:  "INFO ",
+	WarnLevel:  "WARN ",
+	ErrorLevel: "ERROR",
+	FatalLevel: "FATAL",
+}
+
+func (l Level) String() string {
+	if l < DebugLevel || l > FatalLevel {
+		return fmt.Sprintf("Level(%d)", int32(l))
+	}
+	return strings.TrimSpace(levelNames[l])
+}
+
+// 解析级别名, 不区分大小写
+func ParseLevel(s string) (Level, error) {
+	for l := DebugLevel; l <= FatalLevel; l++ {
+		if strings.EqualFold(s, l.String()) {
+			return l, nil
+		}
+	}
+	return InfoLevel, fmt.Errorf("log: unknown level %q", s)
+}
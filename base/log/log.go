@@ -1,3 +1,204 @@
 package log
 
 // 基于muduo实现高性能日志库
+//
+// 前端 Logger 负责级别过滤与格式化, 后端 Sink 负责输出:
+//   NewWriterSink - 同步写 io.Writer (默认 os.Stderr)
+//   NewFileSink   - 按大小/时间滚动的日志文件
+//   NewAsync      - 异步双缓冲, 包装任意 Sink
+//
+//   fs, _ := log.NewFileSink("/var/log/app", 1<<30, 24*time.Hour)
+//   log.SetOutput(log.NewAsync(fs, 3*time.Second))
+//   defer log.Close()
+//
+// 默认级别 Info, 可通过环境变量 MDGO_LOG_LEVEL 设置
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const timeLayout = "2006/01/02 15:04:05.000000"
+
+type Logger struct {
+	level int32
+	sink  atomic.Value // sinkHolder
+}
+
+type sinkHolder struct {
+	Sink
+}
+
+func New(sink Sink, level Level) *Logger {
+	l := &Logger{level: int32(level)}
+	l.sink.Store(sinkHolder{sink})
+	return l
+}
+
+func (l *Logger) SetLevel(level Level) {
+	atomic.StoreInt32(&l.level, int32(level))
+}
+
+func (l *Logger) Level() Level {
+	return Level(atomic.LoadInt32(&l.level))
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.Level()
+}
+
+// 替换输出端, 返回旧的 Sink, 由调用方决定是否关闭
+func (l *Logger) SetOutput(sink Sink) Sink {
+	old := l.Sink()
+	l.sink.Store(sinkHolder{sink})
+	return old
+}
+
+func (l *Logger) Sink() Sink {
+	return l.sink.Load().(sinkHolder).Sink
+}
+
+func (l *Logger) Flush() error {
+	return l.Sink().Flush()
+}
+
+func (l *Logger) Close() error {
+	return l.Sink().Close()
+}
+
+var linePool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// 格式: 2006/01/02 15:04:05.000000 INFO  file.go:123: msg
+// calldepth 为调用 Output 的函数到日志调用点之间的层数
+func (l *Logger) Output(calldepth int, level Level, format string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	now := time.Now()
+	_, file, line, ok := runtime.Caller(calldepth + 1)
+	if !ok {
+		file, line = "???", 0
+	} else {
+		for i := len(file) - 1; i > 0; i-- {
+			if file[i] == '/' {
+				file = file[i+1:]
+				break
+			}
+		}
+	}
+
+	var scratch [64]byte
+	buf := linePool.Get().(*bytes.Buffer)
+	buf.Reset()
+	buf.Write(now.AppendFormat(scratch[:0], timeLayout))
+	buf.WriteByte(' ')
+	buf.WriteString(levelNames[level])
+	buf.WriteByte(' ')
+	buf.WriteString(file)
+	buf.WriteByte(':')
+	buf.Write(strconv.AppendInt(scratch[:0], int64(line), 10))
+	buf.WriteString(": ")
+	fmt.Fprintf(buf, format, args...)
+	if b := buf.Bytes(); len(b) == 0 || b[len(b)-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+	_, _ = l.Sink().Write(buf.Bytes())
+	linePool.Put(buf)
+
+	if level == FatalLevel {
+		_ = l.Close()
+		os.Exit(1)
+	}
+}
+
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.Output(1, DebugLevel, format, args...)
+}
+
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.Output(1, InfoLevel, format, args...)
+}
+
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.Output(1, WarnLevel, format, args...)
+}
+
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.Output(1, ErrorLevel, format, args...)
+}
+
+// 输出后关闭 Sink 并退出进程
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	l.Output(1, FatalLevel, format, args...)
+}
+
+// ******************* 默认 Logger ******************* //
+
+var std = New(NewWriterSink(os.Stderr), InfoLevel)
+
+func init() {
+	if s := os.Getenv("MDGO_LOG_LEVEL"); s != "" {
+		if level, err := ParseLevel(s); err == nil {
+			std.SetLevel(level)
+		}
+	}
+}
+
+func Default() *Logger {
+	return std
+}
+
+func SetLevel(level Level) {
+	std.SetLevel(level)
+}
+
+func GetLevel() Level {
+	return std.Level()
+}
+
+func Enabled(level Level) bool {
+	return std.Enabled(level)
+}
+
+func SetOutput(sink Sink) Sink {
+	return std.SetOutput(sink)
+}
+
+func Flush() error {
+	return std.Flush()
+}
+
+func Close() error {
+	return std.Close()
+}
+
+func Debugf(format string, args ...interface{}) {
+	std.Output(1, DebugLevel, format, args...)
+}
+
+func Infof(format string, args ...interface{}) {
+	std.Output(1, InfoLevel, format, args...)
+}
+
+func Warnf(format string, args ...interface{}) {
+	std.Output(1, WarnLevel, format, args...)
+}
+
+func Errorf(format string, args ...interface{}) {
+	std.Output(1, ErrorLevel, format, args...)
+}
+
+func Fatalf(format string, args ...interface{}) {
+	std.Output(1, FatalLevel, format, args...)
+}
@@ -0,0 +1,138 @@
+package log
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 记录写入内容的 Sink
+type memSink struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	writes  int
+	flushes int
+	closed  bool
+}
+
+func (s *memSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writes++
+	return s.buf.Write(p)
+}
+
+func (s *memSink) Flush() error {
+	s.mu.Lock()
+	s.flushes++
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memSink) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memSink) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.String()
+}
+
+func TestLoggerFormat(t *testing.T) {
+	sink := &memSink{}
+	l := New(sink, DebugLevel)
+	l.Infof("hello %s", "world")
+	l.Errorf("fd: %d\n", 7)
+
+	lines := strings.Split(strings.TrimSuffix(sink.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines: %q", len(lines), sink.String())
+	}
+	re := regexp.MustCompile(`^\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}\.\d{6} (INFO |ERROR) log_test\.go:\d+: (.*)$`)
+	want := []string{"hello world", "fd: 7"}
+	for i, line := range lines {
+		m := re.FindStringSubmatch(line)
+		if m == nil {
+			t.Fatalf("line %d has unexpected format: %q", i, line)
+		}
+		if m[2] != want[i] {
+			t.Fatalf("line %d: got %q, want %q", i, m[2], want[i])
+		}
+	}
+}
+
+func TestLoggerLevel(t *testing.T) {
+	sink := &memSink{}
+	l := New(sink, WarnLevel)
+	l.Debugf("debug")
+	l.Infof("info")
+	l.Warnf("warn")
+	l.Errorf("error")
+
+	out := sink.String()
+	if strings.Contains(out, "debug") || strings.Contains(out, "info") {
+		t.Fatalf("filtered levels were written: %q", out)
+	}
+	if !strings.Contains(out, "warn") || !strings.Contains(out, "error") {
+		t.Fatalf("missing enabled levels: %q", out)
+	}
+
+	l.SetLevel(DebugLevel)
+	l.Debugf("debug")
+	if !strings.Contains(sink.String(), "DEBUG") {
+		t.Fatalf("SetLevel did not take effect: %q", sink.String())
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for l := DebugLevel; l <= FatalLevel; l++ {
+		got, err := ParseLevel(strings.ToLower(l.String()))
+		if err != nil || got != l {
+			t.Fatalf("ParseLevel(%q) = %v, %v", l.String(), got, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Fatal("expected error for unknown level")
+	}
+}
+
+func TestSetOutput(t *testing.T) {
+	sink := &memSink{}
+	old := SetOutput(sink)
+	defer SetOutput(old)
+
+	Errorf("to default")
+	if !strings.Contains(sink.String(), "to default") {
+		t.Fatalf("got %q", sink.String())
+	}
+}
+
+func BenchmarkLoggerDisabled(b *testing.B) {
+	l := New(&memSink{}, InfoLevel)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Debugf("poll return %d events", 3)
+	}
+}
+
+func BenchmarkLoggerAsync(b *testing.B) {
+	a := NewAsync(NewWriterSink(discard{}), 0)
+	defer a.Close()
+	l := New(a, InfoLevel)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			l.Infof("new connection fd: %d", 42)
+		}
+	})
+}
+
+type discard struct{}
+
+func (discard) Write(p []byte) (int, error) { return len(p), nil }
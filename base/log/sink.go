@@ -0,0 +1,45 @@
+package log
+
+import (
+	"io"
+	"sync"
+)
+
+// 日志输出端
+// Write 写入一条或多条完整的日志; Flush 把缓冲的数据落盘; Close 之后不再写入
+// 实现需保证并发安全
+type Sink interface {
+	io.Writer
+	Flush() error
+	Close() error
+}
+
+type writerSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// 包装 io.Writer, 同步写入; Close 不会关闭 w
+func NewWriterSink(w io.Writer) Sink {
+	return &writerSink{w: w}
+}
+
+func (s *writerSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	n, err := s.w.Write(p)
+	s.mu.Unlock()
+	return n, err
+}
+
+func (s *writerSink) Flush() error {
+	if f, ok := s.w.(interface{ Flush() error }); ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return f.Flush()
+	}
+	return nil
+}
+
+func (s *writerSink) Close() error {
+	return s.Flush()
+}
@@ -1,9 +1,12 @@
 package buffer
 
 import (
+	"bytes"
 	"encoding/binary"
 	"syscall"
 	"unsafe"
+
+	"github.com/aizsfgk/mdgo/base/log"
 )
 
 const (
@@ -27,10 +30,14 @@ type FixBuffer struct {
 }
 
 func NewFixBuffer() *FixBuffer {
+	return newFixBufferSize(kInitSize)
+}
+
+func newFixBufferSize(size int) *FixBuffer {
 	return &FixBuffer{
 		ri:  cheapPrepend,
 		wi:  cheapPrepend,
-		buf: make([]byte, kInitSize),
+		buf: make([]byte, size),
 	}
 }
 
@@ -51,21 +58,28 @@ func readv(fd int, iovecs []syscall.Iovec, iovecLen int) (uintptr, syscall.Errno
 	return r, 0
 }
 
-func (f *FixBuffer) ReadFd(fd int) (n int, syscallErr syscall.Errno) {
-	var extraBuf [65536]byte
-	var iovecsLen = 2
-	iovecs := make([]syscall.Iovec, 2)
+// 从 fd 读取数据, 可写空间不足时多出的数据先读入 extraBuf 再追加
+// extraBuf 只在调用期间使用, 可由同一协程的多个缓冲共享
+func (f *FixBuffer) ReadFd(fd int, extraBuf []byte) (n int, syscallErr syscall.Errno) {
+	var iovecs [2]syscall.Iovec
+	var iovecsLen = 0
 
+	if len(extraBuf) == 0 { // 没有临时缓冲, 保证有可写空间
+		f.EnsureWritable(kInitSize)
+	}
 	writable := f.WritableBytes()
-	iovecs[0].Base = &f.buf[f.wi]
-	iovecs[0].Len = uint64(writable)
-	iovecs[1].Base = &extraBuf[0]
-	iovecs[1].Len = 65536
-
-	if writable >= 65536 {
-		iovecsLen = 1
+	if writable > 0 {
+		iovecs[iovecsLen].Base = &f.buf[f.wi]
+		iovecs[iovecsLen].SetLen(writable)
+		iovecsLen++
+	}
+	if writable < len(extraBuf) { // 可写空间足够时不使用 extraBuf
+		iovecs[iovecsLen].Base = &extraBuf[0]
+		iovecs[iovecsLen].SetLen(len(extraBuf))
+		iovecsLen++
 	}
-	r0, err := readv(fd, iovecs, iovecsLen)
+
+	r0, err := readv(fd, iovecs[:], iovecsLen)
 	n = int(r0)
 	if n < 0 {
 		syscallErr = err
@@ -96,9 +110,14 @@ func (f *FixBuffer) PrependableBytes() int {
 	return f.ri
 }
 
+func (f *FixBuffer) Cap() int {
+	return cap(f.buf)
+}
+
 // *************** retrieve *************** //
 func (f *FixBuffer) Retrieve(len int) {
-	if len > f.ReadableBytes() { // FIXME Error
+	if len > f.ReadableBytes() {
+		log.Errorf("buffer: retrieve %d bytes, readable %d", len, f.ReadableBytes())
 		return
 	}
 	if len < f.ReadableBytes() {
@@ -147,12 +166,43 @@ func (f *FixBuffer) RetrieveAsBytes(len int) (ret []byte) {
 }
 
 // ************** write / append **************** //
+
+// 保证可写空间不小于 n
+func (f *FixBuffer) EnsureWritable(n int) {
+	if f.WritableBytes() < n {
+		f.makeSpace(n)
+	}
+}
+
+// 可写空间加上多余的预留空间足够时, 把可读数据移到 cheapPrepend 处;
+// 否则按 2 倍扩容, 扩容的同时整理
+func (f *FixBuffer) makeSpace(n int) {
+	readable := f.ReadableBytes()
+	if f.WritableBytes()+f.PrependableBytes() < n+cheapPrepend {
+		size := 2 * len(f.buf)
+		if need := cheapPrepend + readable + n; size < need {
+			size = need
+		}
+		buf := make([]byte, size)
+		copy(buf[cheapPrepend:], f.buf[f.ri:f.wi])
+		f.buf = buf
+	} else {
+		copy(f.buf[cheapPrepend:], f.buf[f.ri:f.wi])
+	}
+	f.ri = cheapPrepend
+	f.wi = f.ri + readable
+}
+
+// 追加到 writerIndex 之后
 func (f *FixBuffer) Append(b []byte) {
-	f.buf = append(f.buf[:len(f.buf)], b...)
+	f.EnsureWritable(len(b))
+	f.wi += copy(f.buf[f.wi:], b)
 }
 
 func (f *FixBuffer) AppendByte(b byte) {
-	f.buf = append(f.buf[:len(f.buf)], b)
+	f.EnsureWritable(1)
+	f.buf[f.wi] = b
+	f.wi++
 }
 
 func (f *FixBuffer) UnWrite(len int) {
@@ -170,26 +220,23 @@ func (f *FixBuffer) HasWrite(len int) {
 
 func (f *FixBuffer) appendUint64(x uint64) {
 	// 本机字节序 -> 网络字节序
-	var xb []byte
-	binary.BigEndian.PutUint64(xb, x)
-	f.Append(xb)
-	f.HasWrite(len(xb))
+	var xb [8]byte
+	binary.BigEndian.PutUint64(xb[:], x)
+	f.Append(xb[:])
 }
 
 func (f *FixBuffer) appendUint32(x uint32) {
 	// 本机字节序 -> 网络字节序
-	var xb []byte
-	binary.BigEndian.PutUint32(xb, x)
-	f.Append(xb)
-	f.HasWrite(len(xb))
+	var xb [4]byte
+	binary.BigEndian.PutUint32(xb[:], x)
+	f.Append(xb[:])
 }
 
 func (f *FixBuffer) appendUint16(x uint16) {
 	// 本机字节序 -> 网络字节序
-	var xb []byte
-	binary.BigEndian.PutUint16(xb, x)
-	f.Append(xb)
-	f.HasWrite(len(xb))
+	var xb [2]byte
+	binary.BigEndian.PutUint16(xb[:], x)
+	f.Append(xb[:])
 }
 
 func (f *FixBuffer) appendUint8(x uint8) {
@@ -234,7 +281,8 @@ func (f *FixBuffer) Peek(len int) (b []byte) {
 	if len <= 0 {
 		return
 	}
-	if len > f.ReadableBytes() { // log error
+	if len > f.ReadableBytes() {
+		log.Debugf("buffer: peek %d bytes, readable %d", len, f.ReadableBytes())
 		return
 	}
 	b = f.buf[f.ri : f.ri+len]
@@ -258,8 +306,8 @@ func (f *FixBuffer) PeekUint32() uint32 {
 }
 
 func (f *FixBuffer) PeekUint16() uint16 {
-	b := f.Peek(4)
-	if len(b) == 4 {
+	b := f.Peek(2)
+	if len(b) == 2 {
 		return binary.BigEndian.Uint16(b)
 	}
 	return 0
@@ -274,6 +322,29 @@ func (f *FixBuffer) PeekUint8() uint8 {
 
 }
 
+// ******************* find ******************** //
+
+var crlf = []byte("\r\n")
+
+// 在可读数据中查找, 返回相对 readerIndex 的偏移, 未找到返回 -1
+func (f *FixBuffer) Index(sep []byte) int {
+	return bytes.Index(f.PeekAll(), sep)
+}
+
+func (f *FixBuffer) IndexByte(c byte) int {
+	return bytes.IndexByte(f.PeekAll(), c)
+}
+
+// 查找 "\r\n"
+func (f *FixBuffer) FindCRLF() int {
+	return f.Index(crlf)
+}
+
+// 查找 "\n"
+func (f *FixBuffer) FindEOL() int {
+	return f.IndexByte('\n')
+}
+
 // ******************* prepend **************** //
 
 func (f *FixBuffer) Prepend(b []byte) {
@@ -287,21 +358,21 @@ func (f *FixBuffer) Prepend(b []byte) {
 }
 
 func (f *FixBuffer) PrependUint64(x uint64) {
-	var xb []byte
-	binary.BigEndian.PutUint64(xb, x)
-	f.Prepend(xb)
+	var xb [8]byte
+	binary.BigEndian.PutUint64(xb[:], x)
+	f.Prepend(xb[:])
 }
 
 func (f *FixBuffer) PrependUint32(x uint32) {
-	var xb []byte
-	binary.BigEndian.PutUint32(xb, x)
-	f.Prepend(xb)
+	var xb [4]byte
+	binary.BigEndian.PutUint32(xb[:], x)
+	f.Prepend(xb[:])
 }
 
 func (f *FixBuffer) PrependUint16(x uint16) {
-	var xb []byte
-	binary.BigEndian.PutUint16(xb, x)
-	f.Prepend(xb)
+	var xb [2]byte
+	binary.BigEndian.PutUint16(xb[:], x)
+	f.Prepend(xb[:])
 }
 
 func (f *FixBuffer) PrependUint8(x uint8) {
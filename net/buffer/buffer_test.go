@@ -1 +1,94 @@
 package buffer
+
+import "testing"
+
+func TestFind(t *testing.T) {
+	f := NewFixBuffer()
+	f.Append([]byte("xxab\ncd\r\nef"))
+	f.Retrieve(2)
+
+	if got := f.FindEOL(); got != 2 {
+		t.Fatalf("FindEOL: got %d, want 2", got)
+	}
+	if got := f.FindCRLF(); got != 5 {
+		t.Fatalf("FindCRLF: got %d, want 5", got)
+	}
+	if got := f.IndexByte('e'); got != 7 {
+		t.Fatalf("IndexByte: got %d, want 7", got)
+	}
+	if got := f.Index([]byte("cd")); got != 3 {
+		t.Fatalf("Index: got %d, want 3", got)
+	}
+	if got := f.Index([]byte("zz")); got != -1 {
+		t.Fatalf("Index: got %d, want -1", got)
+	}
+
+	f.RetrieveAll()
+	if got := f.FindEOL(); got != -1 {
+		t.Fatalf("FindEOL on empty buffer: got %d, want -1", got)
+	}
+}
+
+func TestAppendCompacts(t *testing.T) {
+	f := NewFixBuffer()
+	chunk := make([]byte, 100)
+	for i := 0; i < 10000; i++ {
+		f.Append(chunk)
+		f.Retrieve(90)
+	}
+	// 可读数据约 100K, 缓冲随数据增长, 而不是随累计写入量增长
+	if f.ReadableBytes() != 10000*10 {
+		t.Fatalf("readable %d", f.ReadableBytes())
+	}
+	if f.Cap() > 4*(f.ReadableBytes()+cheapPrepend) {
+		t.Fatalf("cap %d for %d readable bytes", f.Cap(), f.ReadableBytes())
+	}
+
+	// 读写交替且可读数据很少时不扩容
+	f = NewFixBuffer()
+	f.AppendByte('x')
+	for i := 0; i < 10000; i++ {
+		f.Append(chunk)
+		f.Retrieve(100)
+	}
+	if f.Cap() != kInitSize {
+		t.Fatalf("cap %d, want %d", f.Cap(), kInitSize)
+	}
+	if f.PrependableBytes() < cheapPrepend {
+		t.Fatalf("prependable %d, want >= %d", f.PrependableBytes(), cheapPrepend)
+	}
+}
+
+func TestUint(t *testing.T) {
+	f := NewFixBuffer()
+	f.appendUint64(0x0102030405060708)
+	f.appendUint32(0x090a0b0c)
+	f.appendUint16(0x0d0e)
+	f.appendUint8(0x0f)
+	f.PrependUint16(0xbeef)
+
+	if got := f.ReadableBytes(); got != 2+8+4+2+1 {
+		t.Fatalf("readable %d", got)
+	}
+	if got := f.PeekUint16(); got != 0xbeef {
+		t.Fatalf("PeekUint16: %#x", got)
+	}
+	if got := f.ReadUint16(); got != 0xbeef {
+		t.Fatalf("ReadUint16: %#x", got)
+	}
+	if got := f.ReadUint64(); got != 0x0102030405060708 {
+		t.Fatalf("ReadUint64: %#x", got)
+	}
+	if got := f.ReadUint32(); got != 0x090a0b0c {
+		t.Fatalf("ReadUint32: %#x", got)
+	}
+	if got := f.ReadUint16(); got != 0x0d0e {
+		t.Fatalf("ReadUint16: %#x", got)
+	}
+	if got := f.ReadUint8(); got != 0x0f {
+		t.Fatalf("ReadUint8: %#x", got)
+	}
+	if f.ReadableBytes() != 0 {
+		t.Fatalf("readable %d after reading all", f.ReadableBytes())
+	}
+}
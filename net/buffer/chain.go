@@ -0,0 +1,332 @@
+package buffer
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// writev 一次最多的 iovec 个数, 即 linux 的 IOV_MAX
+	IovMax = 1024
+
+	// 合并小数据的块大小
+	chunkSize = 16 * kInitSize
+
+	// sendfile 一次最多发送的字节数, 同 linux MAX_RW_COUNT
+	maxSendfileSize = 0x7ffff000
+)
+
+// 输出队列中的一块数据, 有三种:
+// 1. buf 非空: 从缓冲池获取的块, 拷贝并合并多次追加的数据
+// 2. file 非空: 文件中 [offset, offset+remain) 的数据, 通过 sendfile 发送
+// 3. 其他: data 引用调用方交出的数据
+type chunk struct {
+	buf    *FixBuffer
+	data   []byte
+	file   *os.File
+	fd     int // file 的描述符
+	offset int64
+	remain int64
+	done   func(err error) // 整块写完或被丢弃时调用
+	next   *chunk
+}
+
+func (ch *chunk) bytes() []byte {
+	if ch.buf != nil {
+		return ch.buf.PeekAll()
+	}
+	return ch.data
+}
+
+// 未写出的字节数
+func (ch *chunk) len() int {
+	if ch.file != nil {
+		return int(ch.remain)
+	}
+	return len(ch.bytes())
+}
+
+// 丢弃前 n 个字节, n 小于 len()
+func (ch *chunk) consume(n int) {
+	switch {
+	case ch.buf != nil:
+		ch.buf.Retrieve(n)
+	case ch.file != nil:
+		ch.offset += int64(n)
+		ch.remain -= int64(n)
+	default:
+		ch.data = ch.data[n:]
+	}
+}
+
+var chunkPool = sync.Pool{
+	New: func() interface{} {
+		return new(chunk)
+	},
+}
+
+// 链式输出缓冲, 参考 redis 的回复链表
+// 数据按块排队, 通过 writev 一次写出多块; 大块数据可以交出所有权, 入队时不拷贝
+//
+//	+--------+    +--------+    +--------+
+//	| chunk  | -> | chunk  | -> | chunk  |
+//	+--------+    +--------+    +--------+
+//	 head                        tail
+type ChainBuffer struct {
+	head *chunk
+	tail *chunk
+	size int // 未写出的字节数
+	n    int // 块数
+}
+
+func NewChainBuffer() *ChainBuffer {
+	return &ChainBuffer{}
+}
+
+func (c *ChainBuffer) ReadableBytes() int {
+	return c.size
+}
+
+// 块数
+func (c *ChainBuffer) Chunks() int {
+	return c.n
+}
+
+func (c *ChainBuffer) push(ch *chunk) {
+	if c.tail == nil {
+		c.head = ch
+	} else {
+		c.tail.next = ch
+	}
+	c.tail = ch
+	c.n++
+}
+
+// 拷贝 b 追加到队尾, 优先填满队尾的块
+func (c *ChainBuffer) Append(b []byte) {
+	c.size += len(b)
+	for len(b) > 0 {
+		t := c.tail
+		if t == nil || t.buf == nil || t.buf.WritableBytes() == 0 {
+			t = chunkPool.Get().(*chunk)
+			t.buf = Get(chunkSize)
+			c.push(t)
+		}
+		n := len(b)
+		if w := t.buf.WritableBytes(); n > w {
+			n = w
+		}
+		t.buf.Append(b[:n])
+		b = b[n:]
+	}
+}
+
+// 不拷贝, 直接把 b 作为一块追加到队尾; 在 done 被调用前 b 不可修改
+// done 在 b 全部写出后以 nil 调用, 被 Release 丢弃时以 Release 的参数调用, 可以为 nil
+func (c *ChainBuffer) AppendOwned(b []byte, done func(err error)) {
+	if len(b) == 0 {
+		if done != nil {
+			done(nil)
+		}
+		return
+	}
+	ch := chunkPool.Get().(*chunk)
+	ch.data = b
+	ch.done = done
+	c.push(ch)
+	c.size += len(b)
+}
+
+// 把文件 f 中 [offset, offset+length) 的数据作为一块追加到队尾, 写出时使用 sendfile
+// 写完或被丢弃之前 f 不可关闭; done 同 AppendOwned
+// f 已关闭时返回错误, 不追加也不调用 done
+func (c *ChainBuffer) AppendFile(f *os.File, offset, length int64, done func(err error)) error {
+	if length <= 0 {
+		if done != nil {
+			done(nil)
+		}
+		return nil
+	}
+	fd, err := fileFd(f)
+	if err != nil {
+		return err
+	}
+	ch := chunkPool.Get().(*chunk)
+	ch.file = f
+	ch.fd = fd
+	ch.offset = offset
+	ch.remain = length
+	ch.done = done
+	c.push(ch)
+	c.size += int(length)
+	return nil
+}
+
+// 文件描述符; 与 f.Fd() 不同, 不会把 f 改为阻塞模式
+func fileFd(f *os.File) (int, error) {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return -1, err
+	}
+	fd := -1
+	if err = rc.Control(func(s uintptr) { fd = int(s) }); err != nil {
+		return -1, err
+	}
+	return fd, nil
+}
+
+// 移除队首的块
+func (c *ChainBuffer) pop() *chunk {
+	ch := c.head
+	c.head = ch.next
+	if c.head == nil {
+		c.tail = nil
+	}
+	c.n--
+	return ch
+}
+
+func (ch *chunk) free() {
+	if ch.buf != nil {
+		Put(ch.buf)
+	}
+	*ch = chunk{}
+	chunkPool.Put(ch)
+}
+
+// 丢弃 n 个字节, 写完的块调用 done(nil) 后回收
+// done 中可以继续追加数据
+func (c *ChainBuffer) Retrieve(n int) {
+	for n > 0 && c.head != nil {
+		ch := c.head
+		l := ch.len()
+		if n < l {
+			ch.consume(n)
+			c.size -= n
+			return
+		}
+		n -= l
+		c.size -= l
+		c.pop()
+		if ch.done != nil {
+			ch.done(nil)
+		}
+		ch.free()
+	}
+}
+
+// 丢弃全部数据, 未写完的块以 err 调用 done
+func (c *ChainBuffer) Release(err error) {
+	for c.head != nil {
+		ch := c.pop()
+		if ch.done != nil {
+			ch.done(err)
+		}
+		ch.free()
+	}
+	c.size = 0
+}
+
+// 同 Release, 但内存块不归还缓冲池
+// 用于已提交给内核的异步写(io_uring)尚未完成时, 内核可能仍在读取这些块
+func (c *ChainBuffer) Drop(err error) {
+	for c.head != nil {
+		ch := c.pop()
+		if ch.done != nil {
+			ch.done(err)
+		}
+		ch.buf = nil
+		ch.free()
+	}
+	c.size = 0
+}
+
+func writev(fd int, iovecs []syscall.Iovec) (uintptr, syscall.Errno) {
+	var (
+		r uintptr
+		e syscall.Errno
+	)
+	for {
+		r, _, e = syscall.Syscall(syscall.SYS_WRITEV, uintptr(fd), uintptr(unsafe.Pointer(&iovecs[0])), uintptr(len(iovecs)))
+		if e != syscall.EINTR {
+			break
+		}
+	}
+	return r, e
+}
+
+// 通过 writev 写出队首最多 len(iovecs) 块数据, 并丢弃已写出的部分
+// 队首为文件块时改为 sendfile 写出该块
+// iovecs 只在调用期间使用, 可由同一协程的多个缓冲共享, 长度一般为 IovMax
+func (c *ChainBuffer) WriteFd(fd int, iovecs []syscall.Iovec) (n int, syscallErr syscall.Errno) {
+	if c.head != nil && c.head.file != nil {
+		return c.sendFile(fd)
+	}
+
+	cnt := c.Iovecs(iovecs)
+	if cnt == 0 {
+		return 0, 0
+	}
+
+	r0, err := writev(fd, iovecs[:cnt])
+	for i := 0; i < cnt; i++ {
+		iovecs[i] = syscall.Iovec{}
+	}
+	if err != 0 {
+		return 0, err
+	}
+	n = int(r0)
+	c.Retrieve(n)
+	return n, 0
+}
+
+// 队首是否为文件块, 文件块只能通过 WriteFd 写出
+func (c *ChainBuffer) HeadIsFile() bool {
+	return c.head != nil && c.head.file != nil
+}
+
+// 以队首的内存块填充 iovecs, 遇到文件块为止, 返回填充的个数
+// 写出之后调用 Retrieve 丢弃已写出的部分, 在此之前追加数据不会移动这些块
+func (c *ChainBuffer) Iovecs(iovecs []syscall.Iovec) int {
+	cnt := 0
+	for ch := c.head; ch != nil && ch.file == nil && cnt < len(iovecs); ch = ch.next {
+		b := ch.bytes()
+		iovecs[cnt].Base = &b[0]
+		iovecs[cnt].SetLen(len(b))
+		cnt++
+	}
+	return cnt
+}
+
+// 文件比预期短时返回 EIO, 剩余数据无法发送
+func (c *ChainBuffer) sendFile(fd int) (int, syscall.Errno) {
+	ch := c.head
+	count := ch.remain
+	if count > maxSendfileSize {
+		count = maxSendfileSize
+	}
+	offset := ch.offset
+	var (
+		n   int
+		err error
+	)
+	for {
+		n, err = syscall.Sendfile(fd, ch.fd, &offset, int(count))
+		if err != syscall.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		if errno, ok := err.(syscall.Errno); ok {
+			return 0, errno
+		}
+		return 0, syscall.EIO
+	}
+	if n == 0 {
+		return 0, syscall.EIO
+	}
+	c.Retrieve(n)
+	return n, 0
+}
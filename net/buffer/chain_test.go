@@ -0,0 +1,285 @@
+package buffer
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func nonblockPipe(t *testing.T) (r, w int) {
+	t.Helper()
+	var p [2]int
+	if err := syscall.Pipe2(p[:], syscall.O_NONBLOCK|syscall.O_CLOEXEC); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = syscall.Close(p[0])
+		_ = syscall.Close(p[1])
+	})
+	return p[0], p[1]
+}
+
+// 读空 fd 中的数据
+func drain(t *testing.T, fd int) []byte {
+	t.Helper()
+	var out []byte
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := syscall.Read(fd, buf)
+		if err == syscall.EAGAIN {
+			return out
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, buf[:n]...)
+	}
+}
+
+func TestChainBufferAppend(t *testing.T) {
+	c := NewChainBuffer()
+	for i := 0; i < 100; i++ {
+		c.Append([]byte("0123456789"))
+	}
+	if c.Chunks() != 1 || c.ReadableBytes() != 1000 {
+		t.Fatalf("small appends: chunks %d, readable %d", c.Chunks(), c.ReadableBytes())
+	}
+
+	c.Append(make([]byte, 2*chunkSize))
+	if c.Chunks() != 3 || c.ReadableBytes() != 1000+2*chunkSize {
+		t.Fatalf("large append: chunks %d, readable %d", c.Chunks(), c.ReadableBytes())
+	}
+
+	// 交出所有权的数据单独成块, 之后的拷贝另起一块
+	c.AppendOwned([]byte("owned"), nil)
+	c.Append([]byte("x"))
+	if c.Chunks() != 5 {
+		t.Fatalf("chunks %d, want 5", c.Chunks())
+	}
+	c.Release(nil)
+	if c.Chunks() != 0 || c.ReadableBytes() != 0 {
+		t.Fatalf("after Release: chunks %d, readable %d", c.Chunks(), c.ReadableBytes())
+	}
+}
+
+func TestChainBufferWriteFd(t *testing.T) {
+	r, w := nonblockPipe(t)
+	iovecs := make([]syscall.Iovec, IovMax)
+
+	c := NewChainBuffer()
+	owned := bytes.Repeat([]byte("o"), 1000)
+	var doneErrs []error
+	c.Append([]byte("head,"))
+	c.AppendOwned(owned, func(err error) { doneErrs = append(doneErrs, err) })
+	c.Append([]byte(",tail"))
+
+	n, err := c.WriteFd(w, iovecs)
+	if err != 0 || n != 1010 {
+		t.Fatalf("WriteFd: n %d, err %v", n, err)
+	}
+	want := "head," + string(owned) + ",tail"
+	if got := string(drain(t, r)); got != want {
+		t.Fatalf("got %q", got)
+	}
+	if len(doneErrs) != 1 || doneErrs[0] != nil {
+		t.Fatalf("done: %v", doneErrs)
+	}
+	if c.Chunks() != 0 || c.ReadableBytes() != 0 {
+		t.Fatalf("chunks %d, readable %d", c.Chunks(), c.ReadableBytes())
+	}
+	for _, iov := range iovecs {
+		if iov.Base != nil {
+			t.Fatal("iovecs still reference written data")
+		}
+	}
+}
+
+// 内核缓冲区写满时部分写出, done 只在整块写完后调用, 数据保持顺序
+func TestChainBufferPartialWrite(t *testing.T) {
+	r, w := nonblockPipe(t)
+	iovecs := make([]syscall.Iovec, IovMax)
+
+	c := NewChainBuffer()
+	var want []byte
+	var done []int
+	for i := 0; i < 4; i++ {
+		i := i
+		b := bytes.Repeat([]byte{byte('a' + i)}, 100*1024)
+		want = append(want, b...)
+		c.AppendOwned(b, func(err error) {
+			if err != nil {
+				t.Errorf("chunk %d: %v", i, err)
+			}
+			done = append(done, i)
+		})
+	}
+
+	var got []byte
+	for c.ReadableBytes() > 0 {
+		before := c.ReadableBytes()
+		n, err := c.WriteFd(w, iovecs)
+		if err != 0 && err != syscall.EAGAIN {
+			t.Fatal(err)
+		}
+		if c.ReadableBytes() != before-n {
+			t.Fatalf("readable %d after writing %d of %d", c.ReadableBytes(), n, before)
+		}
+		// 已完成的块数与已写出的字节数一致
+		if written := len(want) - c.ReadableBytes(); len(done) != written/(100*1024) {
+			t.Fatalf("%d chunks done after %d bytes", len(done), written)
+		}
+		got = append(got, drain(t, r)...)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("data mismatch")
+	}
+	if len(done) != 4 || done[0] != 0 || done[3] != 3 {
+		t.Fatalf("done order %v", done)
+	}
+}
+
+func TestChainBufferIovMax(t *testing.T) {
+	r, w := nonblockPipe(t)
+	iovecs := make([]syscall.Iovec, IovMax)
+
+	c := NewChainBuffer()
+	one := []byte("x")
+	for i := 0; i < IovMax+100; i++ {
+		c.AppendOwned(one, nil)
+	}
+	n, err := c.WriteFd(w, iovecs)
+	if err != 0 || n != IovMax {
+		t.Fatalf("first writev: n %d, err %v", n, err)
+	}
+	n, err = c.WriteFd(w, iovecs)
+	if err != 0 || n != 100 {
+		t.Fatalf("second writev: n %d, err %v", n, err)
+	}
+	if got := len(drain(t, r)); got != IovMax+100 {
+		t.Fatalf("read %d bytes", got)
+	}
+}
+
+func TestChainBufferRelease(t *testing.T) {
+	closed := errors.New("closed")
+	c := NewChainBuffer()
+	var errs []error
+	for i := 0; i < 3; i++ {
+		c.AppendOwned([]byte("data"), func(err error) { errs = append(errs, err) })
+	}
+	// 空数据立即完成
+	c.AppendOwned(nil, func(err error) { errs = append(errs, err) })
+	if len(errs) != 1 || errs[0] != nil {
+		t.Fatalf("empty chunk: %v", errs)
+	}
+
+	c.Retrieve(6) // 写完第一块及第二块的一部分
+	c.Release(closed)
+	if len(errs) != 4 || errs[1] != nil || errs[2] != closed || errs[3] != closed {
+		t.Fatalf("got %v", errs)
+	}
+}
+
+func BenchmarkChainBufferWriteFd(b *testing.B) {
+	var p [2]int
+	if err := syscall.Pipe2(p[:], syscall.O_NONBLOCK|syscall.O_CLOEXEC); err != nil {
+		b.Fatal(err)
+	}
+	defer syscall.Close(p[0])
+	defer syscall.Close(p[1])
+	iovecs := make([]syscall.Iovec, IovMax)
+	msg := make([]byte, 128)
+	buf := make([]byte, 64*1024)
+
+	c := NewChainBuffer()
+	b.ReportAllocs()
+	b.SetBytes(int64(64 * len(msg)))
+	for i := 0; i < b.N; i++ {
+		// 64 次小的发送合并为一次 writev
+		for j := 0; j < 64; j++ {
+			c.Append(msg)
+		}
+		if _, err := c.WriteFd(p[1], iovecs); err != 0 {
+			b.Fatal(err)
+		}
+		_, _ = syscall.Read(p[0], buf)
+	}
+}
+
+func tempFile(t *testing.T, content []byte) *os.File {
+	t.Helper()
+	f, err := ioutil.TempFile(t.TempDir(), "chain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	if _, err = f.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestChainBufferFile(t *testing.T) {
+	r, w := nonblockPipe(t)
+	iovecs := make([]syscall.Iovec, IovMax)
+
+	content := bytes.Repeat([]byte("0123456789"), 30*1024)
+	f := tempFile(t, content)
+
+	c := NewChainBuffer()
+	var done []error
+	c.Append([]byte("header|"))
+	c.AppendFile(f, 5, int64(len(content)-10), func(err error) { done = append(done, err) })
+	c.Append([]byte("|trailer"))
+	want := "header|" + string(content[5:len(content)-5]) + "|trailer"
+	if c.ReadableBytes() != len(want) {
+		t.Fatalf("readable %d, want %d", c.ReadableBytes(), len(want))
+	}
+
+	var got []byte
+	for c.ReadableBytes() > 0 {
+		if _, err := c.WriteFd(w, iovecs); err != 0 && err != syscall.EAGAIN {
+			t.Fatal(err)
+		}
+		got = append(got, drain(t, r)...)
+	}
+	if string(got) != want {
+		t.Fatalf("data mismatch: got %d bytes, want %d", len(got), len(want))
+	}
+	if len(done) != 1 || done[0] != nil {
+		t.Fatalf("done: %v", done)
+	}
+}
+
+func TestChainBufferFileTruncated(t *testing.T) {
+	_, w := nonblockPipe(t)
+	iovecs := make([]syscall.Iovec, IovMax)
+	f := tempFile(t, []byte("short"))
+
+	c := NewChainBuffer()
+	c.AppendFile(f, 0, 100, nil)
+	if n, err := c.WriteFd(w, iovecs); err != 0 || n != 5 {
+		t.Fatalf("first sendfile: n %d, err %v", n, err)
+	}
+	if _, err := c.WriteFd(w, iovecs); err != syscall.EIO {
+		t.Fatalf("got %v, want EIO", err)
+	}
+	c.Release(nil)
+}
+
+func TestChainBufferFileClosed(t *testing.T) {
+	f := tempFile(t, []byte("closed"))
+	_ = f.Close()
+
+	c := NewChainBuffer()
+	called := false
+	if err := c.AppendFile(f, 0, 6, func(err error) { called = true }); err == nil {
+		t.Fatal("closed file is appended")
+	}
+	if c.ReadableBytes() != 0 || called {
+		t.Fatalf("readable %d, done called %v", c.ReadableBytes(), called)
+	}
+}
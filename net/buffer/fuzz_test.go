@@ -0,0 +1,104 @@
+//go:build go1.18
+// +build go1.18
+
+package buffer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// 按输入执行一串读写操作, 与作为参照的切片比较, 每步检查下标不变式
+func FuzzFixBuffer(f *testing.F) {
+	f.Add([]byte{0, 10, 2, 3, 5, 4, 1, 7})
+	f.Add([]byte{0, 255, 0, 255, 0, 255, 0, 255, 0, 255, 2, 250, 8, 200, 9, 0})
+	f.Add([]byte{5, 8, 6, 0, 7, 0, 10, 3, 3, 0})
+
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		b := NewFixBuffer()
+		var model []byte
+		seq := byte(0)
+		// 每次生成不同内容, 便于发现数据错位
+		data := func(n int) []byte {
+			d := make([]byte, n)
+			for i := range d {
+				seq++
+				d[i] = seq
+			}
+			return d
+		}
+
+		for i := 0; i+1 < len(ops); i += 2 {
+			op, arg := ops[i]%11, int(ops[i+1])
+			switch op {
+			case 0: // Append, 放大以触发扩容
+				d := data(arg * 7)
+				b.Append(d)
+				model = append(model, d...)
+			case 1:
+				d := data(1)
+				b.AppendByte(d[0])
+				model = append(model, d[0])
+			case 2:
+				b.Retrieve(arg)
+				if arg <= len(model) {
+					model = model[arg:]
+				}
+			case 3:
+				b.RetrieveAll()
+				model = model[:0]
+			case 4:
+				got := b.RetrieveAsBytes(arg)
+				if arg <= len(model) {
+					if !bytes.Equal(got, model[:arg]) {
+						t.Fatalf("RetrieveAsBytes(%d): got %v, want %v", arg, got, model[:arg])
+					}
+					model = model[arg:]
+				}
+			case 5:
+				d := data(arg % 16)
+				prependable := b.PrependableBytes()
+				b.Prepend(d)
+				if len(d) <= prependable {
+					model = append(d, model...)
+				}
+			case 6:
+				var x [4]byte
+				binary.BigEndian.PutUint32(x[:], uint32(arg)*0x01010101)
+				b.appendUint32(uint32(arg) * 0x01010101)
+				model = append(model, x[:]...)
+			case 7:
+				if len(model) >= 2 {
+					want := binary.BigEndian.Uint16(model)
+					if got := b.ReadUint16(); got != want {
+						t.Fatalf("ReadUint16: got %#x, want %#x", got, want)
+					}
+					model = model[2:]
+				}
+			case 8:
+				b.EnsureWritable(arg * 37)
+				if b.WritableBytes() < arg*37 {
+					t.Fatalf("EnsureWritable(%d): writable %d", arg*37, b.WritableBytes())
+				}
+			case 9:
+				b.Shrink()
+			case 10:
+				b.UnWrite(arg)
+				if arg <= len(model) {
+					model = model[:len(model)-arg]
+				}
+			}
+
+			if b.ri < 0 || b.ri > b.wi || b.wi > len(b.buf) || len(b.buf) != cap(b.buf) {
+				t.Fatalf("op %d: bad indexes ri %d, wi %d, len %d, cap %d", op, b.ri, b.wi, len(b.buf), cap(b.buf))
+			}
+			if b.ReadableBytes() != len(model) || !bytes.Equal(b.buf[b.ri:b.wi], model) {
+				t.Fatalf("op %d: readable %v, want %v", op, b.buf[b.ri:b.wi], model)
+			}
+			if b.WritableBytes() != len(b.buf)-b.wi || b.PrependableBytes() != b.ri {
+				t.Fatalf("op %d: writable %d, prependable %d", op, b.WritableBytes(), b.PrependableBytes())
+			}
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package buffer
+
+import "sync"
+
+// 按容量分级的 FixBuffer 缓冲池, 减少频繁建立/关闭连接时的内存分配
+// 只回收容量恰为某一级别的缓冲, 增长过的缓冲交给 GC, 保证 Get 得到的容量就是级别大小
+var sizeClasses = [...]int{
+	kInitSize,       // 1K
+	4 * kInitSize,   // 4K
+	16 * kInitSize,  // 16K
+	64 * kInitSize,  // 64K
+	256 * kInitSize, // 256K
+}
+
+// 容量超过该值的缓冲在数据读空后归还大缓冲, 换用默认大小
+const shrinkThreshold = 4 * kInitSize
+
+var pools [len(sizeClasses)]sync.Pool
+
+// 可容纳 size 字节的最小级别, 超出返回 -1
+func classOf(size int) int {
+	for i, c := range sizeClasses {
+		if size <= c {
+			return i
+		}
+	}
+	return -1
+}
+
+// 默认容量, 与 NewFixBuffer 相同
+const DefaultSize = kInitSize
+
+// 从缓冲池获取一个容量不小于 size 的缓冲
+func Get(size int) *FixBuffer {
+	i := classOf(size)
+	if i < 0 {
+		return newFixBufferSize(size)
+	}
+	if f, ok := pools[i].Get().(*FixBuffer); ok {
+		return f
+	}
+	return newFixBufferSize(sizeClasses[i])
+}
+
+// 归还缓冲, 归还后不可再使用
+func Put(f *FixBuffer) {
+	if f == nil {
+		return
+	}
+	c := cap(f.buf)
+	i := classOf(c)
+	if i < 0 || sizeClasses[i] != c {
+		return
+	}
+	f.buf = f.buf[:c]
+	f.RetrieveAll()
+	pools[i].Put(f)
+}
+
+// 缓冲增长过大时, 把未读数据移到池中合适大小的缓冲上, 原缓冲归还缓冲池
+func (f *FixBuffer) Shrink() {
+	if cap(f.buf) <= shrinkThreshold {
+		return
+	}
+	nf := Get(cheapPrepend + f.ReadableBytes())
+	if cap(nf.buf) >= cap(f.buf) {
+		Put(nf)
+		return
+	}
+	nf.Append(f.PeekAll())
+	f.Swap(nf)
+	Put(nf)
+}
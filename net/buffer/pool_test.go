@@ -0,0 +1,93 @@
+package buffer
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPoolGet(t *testing.T) {
+	for _, size := range []int{0, 1, DefaultSize, DefaultSize + 1, 100 * 1024, 1 << 20} {
+		f := Get(size)
+		if f.Cap() < size {
+			t.Fatalf("Get(%d): cap %d", size, f.Cap())
+		}
+		if f.ReadableBytes() != 0 || f.PrependableBytes() != cheapPrepend {
+			t.Fatalf("Get(%d): buffer is not reset", size)
+		}
+		f.Append(bytes.Repeat([]byte("x"), size))
+		Put(f)
+	}
+
+	// 归还的缓冲被重置
+	for i := 0; i < 100; i++ {
+		f := Get(DefaultSize)
+		if f.ReadableBytes() != 0 {
+			t.Fatalf("pooled buffer has %d readable bytes", f.ReadableBytes())
+		}
+		f.Append([]byte("dirty"))
+		Put(f)
+	}
+}
+
+// 容量不是整级别的缓冲不回收, Get 得到的容量恰为级别大小
+func TestPoolPutOddCap(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		Put(newFixBufferSize(2 * DefaultSize))
+		Put(newFixBufferSize(DefaultSize - 1))
+	}
+	for i := 0; i < 100; i++ {
+		if f := Get(DefaultSize); f.Cap() != DefaultSize {
+			t.Fatalf("Get(%d): cap %d", DefaultSize, f.Cap())
+		}
+	}
+}
+
+func TestShrink(t *testing.T) {
+	f := NewFixBuffer()
+	data := bytes.Repeat([]byte("0123456789"), 10*1024)
+	f.Append(data)
+	grown := f.Cap()
+
+	f.Retrieve(len(data) - 100)
+	f.Shrink()
+	if f.Cap() >= grown {
+		t.Fatalf("cap %d not shrunk from %d", f.Cap(), grown)
+	}
+	if !bytes.Equal(f.PeekAll(), data[len(data)-100:]) {
+		t.Fatal("data lost after Shrink")
+	}
+
+	f.RetrieveAll()
+	f.Shrink()
+	if f.Cap() != DefaultSize {
+		t.Fatalf("empty buffer cap %d, want %d", f.Cap(), DefaultSize)
+	}
+
+	// 小缓冲不变
+	small := NewFixBuffer()
+	small.Append([]byte("abc"))
+	small.Shrink()
+	if small.Cap() != DefaultSize || small.RetrieveAllAsString() != "abc" {
+		t.Fatal("small buffer changed by Shrink")
+	}
+}
+
+func BenchmarkNewFixBuffer(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		in, out := NewFixBuffer(), NewFixBuffer()
+		in.Append([]byte("ping"))
+		out.Append([]byte("pong"))
+	}
+}
+
+func BenchmarkPoolGetPut(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		in, out := Get(DefaultSize), Get(DefaultSize)
+		in.Append([]byte("ping"))
+		out.Append([]byte("pong"))
+		Put(in)
+		Put(out)
+	}
+}
@@ -0,0 +1,185 @@
+package net
+
+import (
+	"sync"
+	"syscall"
+
+	"github.com/aizsfgk/mdgo/base/atomic"
+	mdgoErr "github.com/aizsfgk/mdgo/net/errors"
+)
+
+// 可选回调: 连接失败
+type ConnectErrorCallback interface {
+	OnConnectError(err error)
+}
+
+// 可选回调: 自动重连, 需设置 Reconnect 选项
+// OnReconnect 在第 attempt 次重连发起前调用
+// OnGiveUp 在达到 MaxAttempts 后调用, err 为最后一次失败的原因
+type ReconnectCallback interface {
+	OnReconnect(cli *Client, attempt int)
+	OnGiveUp(cli *Client, err error)
+}
+
+// 客户端
+// 在指定事件循环上发起一条出站连接, 建立后与服务端连接一样使用 Handler 回调
+// 多个 Client 可以共用同一个事件循环, 例如服务器的 subReactor
+type Client struct {
+	option        *Option     // 配置选项
+	handler       Handler     // 回调句柄
+	loop          *EventLoop  // 所属事件循环
+	connector     *Connector  // 连接器
+	connected     atomic.Bool // 连接是否建立
+	mu            sync.Mutex  // guard conn
+	conn          *Connection // 已建立的连接
+	shouldConnect bool        // 是否需要保持连接(Connect 之后, Disconnect 之前)
+	attempts      int         // 连续重连次数
+	retryTimer    TimerId     // 重连定时器
+}
+
+// 新建客户端, 对端地址由 Addr 选项指定
+func NewClient(loop *EventLoop, handler Handler, optionCbs ...OptionCallback) (cli *Client, err error) {
+	if handler == nil {
+		err = mdgoErr.HandlerIsNil
+		return
+	}
+
+	cli = &Client{
+		option:  newOption(optionCbs...),
+		handler: handler,
+		loop:    loop,
+	}
+	if cli.option.Codec != nil {
+		if _, ok := handler.(FrameCallback); !ok {
+			return nil, mdgoErr.ErrNoFrameCallback
+		}
+	}
+	cli.connector, err = NewConnector(cli.option.Network, cli.option.Addr, cli.option.ConnectTimeout, loop, cli.handleNewConnection, cli.handleConnectError)
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// 发起连接, 结果通过 OnConnection/OnConnectError 回调通知
+// 设置了 Reconnect 选项时, 连接失败或断开后自动重连
+// 已连接或正在连接时忽略; 等待重连时取消等待, 立即连接
+func (cli *Client) Connect() {
+	cli.loop.RunInLoop(func() {
+		if cli.connected.Get() || cli.connector.connecting {
+			return
+		}
+		cli.shouldConnect = true
+		cli.attempts = 0
+		cli.loop.Cancel(cli.retryTimer)
+		cli.retryTimer = TimerId{}
+		cli.connector.connect()
+	})
+}
+
+// 断开连接, 放弃正在进行的连接, 并停止重连
+func (cli *Client) Disconnect() {
+	cli.loop.RunInLoop(func() {
+		cli.shouldConnect = false
+		cli.loop.Cancel(cli.retryTimer)
+		_ = cli.connector.Close()
+		if conn := cli.Conn(); conn != nil {
+			_ = conn.Close()
+		}
+	})
+}
+
+// 已建立的连接, 未连接时为 nil
+func (cli *Client) Conn() *Connection {
+	cli.mu.Lock()
+	defer cli.mu.Unlock()
+	return cli.conn
+}
+
+func (cli *Client) Connected() bool {
+	return cli.connected.Get()
+}
+
+// 连接成功, 在事件循环中执行
+func (cli *Client) handleNewConnection(fd int, sa syscall.Sockaddr) error {
+	if err := applySocketOptions(fd, cli.option); err != nil {
+		cli.option.Logger.Errorf("client: fd %d apply socket options err: %v", fd, err)
+		_ = syscall.Close(fd)
+		cli.handleConnectError(err)
+		return err
+	}
+
+	conn, err := NewConnection(fd, cli.loop, sa, cli.handler)
+	if err != nil {
+		cli.option.Logger.Errorf("client: fd %d new connection err: %v", fd, err)
+		return err
+	}
+	conn.setCodec(cli.option.Codec)
+	conn.setWaterMarks(cli.option.HighWaterMark, cli.option.LowWaterMark)
+	conn.edgeTriggered = cli.option.EdgeTriggered
+	conn.closeCb = cli.removeConnection
+
+	if err = conn.register(); err != nil {
+		cli.option.Logger.Errorf("client: fd %d register err: %v", fd, err)
+		_ = conn.handleClose()
+		return err
+	}
+
+	cli.mu.Lock()
+	cli.conn = conn
+	cli.mu.Unlock()
+	cli.connected.Set(true)
+	cli.attempts = 0
+
+	cli.handler.OnConnection(conn)
+	return nil
+}
+
+func (cli *Client) handleConnectError(err error) {
+	cli.option.Logger.Warnf("client: connect err: %v", err)
+	if cb, ok := cli.handler.(ConnectErrorCallback); ok {
+		cb.OnConnectError(err)
+	}
+	cli.retry(err)
+}
+
+// 连接关闭, 在事件循环中执行
+func (cli *Client) removeConnection(conn *Connection) {
+	cli.connected.Set(false)
+	cli.mu.Lock()
+	if cli.conn == conn {
+		cli.conn = nil
+	}
+	cli.mu.Unlock()
+
+	cli.retry(mdgoErr.ErrConnectionClosed)
+}
+
+// 按重连策略延迟重连, 在事件循环中执行
+func (cli *Client) retry(err error) {
+	policy := cli.option.Retry
+	if policy == nil || !cli.shouldConnect {
+		return
+	}
+
+	cb, _ := cli.handler.(ReconnectCallback)
+	if policy.MaxAttempts > 0 && cli.attempts >= policy.MaxAttempts {
+		cli.shouldConnect = false
+		if cb != nil {
+			cb.OnGiveUp(cli, err)
+		}
+		return
+	}
+
+	cli.attempts++
+	attempt := cli.attempts
+	cli.retryTimer = cli.loop.RunAfter(policy.delay(attempt), func() {
+		if !cli.shouldConnect {
+			return
+		}
+		if cb != nil {
+			cb.OnReconnect(cli, attempt)
+		}
+		cli.connector.connect()
+	})
+}
@@ -0,0 +1,372 @@
+package net
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	mdgoErr "github.com/aizsfgk/mdgo/net/errors"
+)
+
+type clientTestHandler struct {
+	testHandler
+	onConnectError func(err error)
+}
+
+func (h *clientTestHandler) OnConnectError(err error) {
+	if h.onConnectError != nil {
+		h.onConnectError(err)
+	}
+}
+
+// 回显服务器
+func startEchoServer(t testing.TB, optionCbs ...OptionCallback) *testServer {
+	return startTestServer(t, &testHandler{
+		onMessage: func(conn *Connection, nowUnix int64) {
+			_ = conn.Send(conn.InBuf.RetrieveAllAsBytes())
+		},
+	}, optionCbs...)
+}
+
+func TestClientEcho(t *testing.T) {
+	serv := startEchoServer(t)
+	loop, stop := startTestLoop(t)
+	defer stop()
+
+	const clientNum = 100
+	var wg sync.WaitGroup
+	wg.Add(clientNum)
+	handler := &clientTestHandler{}
+	handler.onConnection = func(conn *Connection) {
+		if !conn.Loop().IsInLoop() {
+			t.Error("OnConnection is not run in client loop")
+		}
+		_ = conn.SendString("hello")
+	}
+	handler.onMessage = func(conn *Connection, nowUnix int64) {
+		if conn.InBuf.ReadableBytes() < len("hello") {
+			return
+		}
+		if got := conn.InBuf.RetrieveAllAsString(); got != "hello" {
+			t.Errorf("got %q", got)
+		}
+		wg.Done()
+	}
+	handler.onConnectError = func(err error) {
+		t.Errorf("connect err: %v", err)
+	}
+
+	clients := make([]*Client, clientNum)
+	for i := range clients {
+		cli, err := NewClient(loop, handler, Addr(serv.Addr().String()), ConnectTimeout(5*time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cli.Connect()
+		clients[i] = cli
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("not all clients receive echo")
+	}
+
+	for _, cli := range clients {
+		if !cli.Connected() || cli.Conn() == nil {
+			t.Fatal("client is not connected")
+		}
+		cli.Disconnect()
+	}
+}
+
+// 已连接时再次 Connect 不会建立新连接
+func TestClientConnectTwice(t *testing.T) {
+	serv := startEchoServer(t)
+	loop, stop := startTestLoop(t)
+	defer stop()
+
+	connected := make(chan struct{}, 4)
+	handler := &clientTestHandler{}
+	handler.onConnection = func(conn *Connection) { connected <- struct{}{} }
+	cli, err := NewClient(loop, handler, Addr(serv.Addr().String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Disconnect()
+
+	// 第二次调用时第一次的连接仍在进行中
+	cli.Connect()
+	cli.Connect()
+	select {
+	case <-connected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("client is not connected")
+	}
+	conn := cli.Conn()
+	cli.Connect()
+
+	time.Sleep(50 * time.Millisecond)
+	if len(connected) != 0 || cli.Conn() != conn {
+		t.Fatal("Connect opens another connection")
+	}
+	if n := serv.connNum.Get(); n != 1 {
+		t.Fatalf("server has %d connections, want 1", n)
+	}
+}
+
+func TestClientConnectRefused(t *testing.T) {
+	// 获取一个未监听的端口
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	loop, stop := startTestLoop(t)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	cli, err := NewClient(loop, &clientTestHandler{
+		onConnectError: func(err error) { errCh <- err },
+	}, Addr(addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli.Connect()
+
+	select {
+	case err = <-errCh:
+		var sysErr *os.SyscallError
+		if !errors.As(err, &sysErr) || sysErr.Err != syscall.ECONNREFUSED {
+			t.Fatalf("got err %v, want ECONNREFUSED", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no connect error")
+	}
+	if cli.Connected() {
+		t.Fatal("client should not be connected")
+	}
+}
+
+// 监听队列已满的地址, 内核会丢弃后续的 SYN, connect 无法完成
+func fullBacklogAddr(t *testing.T) string {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = syscall.Close(fd) })
+	if err = syscall.Bind(fd, &syscall.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = syscall.Listen(fd, 0); err != nil {
+		t.Fatal(err)
+	}
+	sa, err := syscall.Getsockname(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := sockAddrToString(sa)
+
+	// 填满监听队列
+	for i := 0; i < 2; i++ {
+		c, err := net.DialTimeout("tcp", addr, 100*time.Millisecond)
+		if err != nil {
+			break
+		}
+		t.Cleanup(func() { c.Close() })
+	}
+	return addr
+}
+
+func TestClientConnectTimeout(t *testing.T) {
+	addr := fullBacklogAddr(t)
+	loop, stop := startTestLoop(t)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	handler := &clientTestHandler{
+		onConnectError: func(err error) { errCh <- err },
+	}
+	handler.onConnection = func(conn *Connection) {
+		errCh <- nil
+	}
+	cli, err := NewClient(loop, handler, Addr(addr), ConnectTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	begin := time.Now()
+	cli.Connect()
+
+	select {
+	case err = <-errCh:
+		if err != mdgoErr.ErrConnectTimeout {
+			t.Fatalf("got err %v, want %v", err, mdgoErr.ErrConnectTimeout)
+		}
+		if cost := time.Since(begin); cost < 100*time.Millisecond {
+			t.Fatalf("timeout after %v", cost)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("connect does not time out")
+	}
+}
+
+type reconnectTestHandler struct {
+	clientTestHandler
+	onReconnect func(cli *Client, attempt int)
+	onGiveUp    func(cli *Client, err error)
+}
+
+func (h *reconnectTestHandler) OnReconnect(cli *Client, attempt int) {
+	if h.onReconnect != nil {
+		h.onReconnect(cli, attempt)
+	}
+}
+
+func (h *reconnectTestHandler) OnGiveUp(cli *Client, err error) {
+	if h.onGiveUp != nil {
+		h.onGiveUp(cli, err)
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{100, time.Second},
+	}
+	for _, tt := range tests {
+		if got := p.delay(tt.attempt); got != tt.want {
+			t.Errorf("delay(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+
+	var zero RetryPolicy
+	if got := zero.delay(1); got != defaultRetryInitialDelay {
+		t.Errorf("default delay(1) = %v", got)
+	}
+	if got := zero.delay(100); got != defaultRetryMaxDelay {
+		t.Errorf("default delay(100) = %v", got)
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.delay(3); got < 200*time.Millisecond || got > 400*time.Millisecond {
+			t.Fatalf("delay(3) with jitter = %v", got)
+		}
+	}
+}
+
+func TestClientReconnectAfterServerRestart(t *testing.T) {
+	serv := startEchoServer(t)
+	addr := serv.Addr().String()
+
+	loop, stop := startTestLoop(t)
+	defer stop()
+
+	connected := make(chan struct{}, 4)
+	closed := make(chan struct{}, 4)
+	reconnects := make(chan int, 64)
+	handler := &reconnectTestHandler{
+		onReconnect: func(cli *Client, attempt int) { reconnects <- attempt },
+	}
+	handler.onConnection = func(conn *Connection) { connected <- struct{}{} }
+	handler.onClose = func() { closed <- struct{}{} }
+
+	cli, err := NewClient(loop, handler, Addr(addr), Reconnect(RetryPolicy{
+		InitialDelay: 10 * time.Millisecond,
+		MaxDelay:     50 * time.Millisecond,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli.Connect()
+	defer cli.Disconnect()
+
+	wait := func(ch chan struct{}, what string) {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("wait %s timeout", what)
+		}
+	}
+	wait(connected, "connected")
+
+	// 对端重启
+	serv.Stop()
+	<-serv.done
+	wait(closed, "closed")
+	time.Sleep(100 * time.Millisecond) // 期间重连失败若干次
+	startEchoServer(t, Addr(addr))
+	wait(connected, "reconnected")
+
+	if len(reconnects) == 0 {
+		t.Fatal("OnReconnect is not called")
+	}
+	if !cli.Connected() {
+		t.Fatal("client is not connected")
+	}
+}
+
+func TestClientReconnectGiveUp(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	loop, stop := startTestLoop(t)
+	defer stop()
+
+	var attempts []int
+	giveUp := make(chan error, 1)
+	handler := &reconnectTestHandler{
+		onReconnect: func(cli *Client, attempt int) { attempts = append(attempts, attempt) },
+		onGiveUp:    func(cli *Client, err error) { giveUp <- err },
+	}
+	cli, err := NewClient(loop, handler, Addr(addr), Reconnect(RetryPolicy{
+		InitialDelay: time.Millisecond,
+		MaxDelay:     5 * time.Millisecond,
+		MaxAttempts:  3,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli.Connect()
+
+	select {
+	case err = <-giveUp:
+		var sysErr *os.SyscallError
+		if !errors.As(err, &sysErr) || sysErr.Err != syscall.ECONNREFUSED {
+			t.Fatalf("give up err %v, want ECONNREFUSED", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnGiveUp is not called")
+	}
+
+	// attempts 只在事件循环中修改, 同步后读取
+	synced := make(chan struct{})
+	loop.RunInLoop(func() { close(synced) })
+	<-synced
+	if len(attempts) != 3 || attempts[0] != 1 || attempts[2] != 3 {
+		t.Fatalf("attempts = %v", attempts)
+	}
+}
@@ -1 +1,32 @@
 package codec
+
+import (
+	"github.com/aizsfgk/mdgo/net/buffer"
+	mdgoErr "github.com/aizsfgk/mdgo/net/errors"
+)
+
+// 默认编解码器: 不分帧
+// Unpack 将缓冲中的全部数据作为一个 []byte 消息; Pack 接受 []byte 或 string
+type Default struct{}
+
+func (Default) Pack(msg interface{}) ([]byte, error) {
+	switch m := msg.(type) {
+	case []byte:
+		return m, nil
+	case string:
+		return []byte(m), nil
+	default:
+		return nil, mdgoErr.ErrUnsupportedMsg
+	}
+}
+
+// 返回的消息是拷贝, 不会被之后读入的数据覆盖
+func (Default) Unpack(in *buffer.FixBuffer) (interface{}, error) {
+	if in.ReadableBytes() == 0 {
+		return nil, nil
+	}
+	msg := make([]byte, in.ReadableBytes())
+	copy(msg, in.PeekAll())
+	in.RetrieveAll()
+	return msg, nil
+}
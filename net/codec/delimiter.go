@@ -0,0 +1,120 @@
+package codec
+
+import (
+	"github.com/aizsfgk/mdgo/net/buffer"
+	mdgoErr "github.com/aizsfgk/mdgo/net/errors"
+)
+
+// 分隔符编解码器, 参考 netty DelimiterBasedFrameDecoder
+// 有多个分隔符时, 以最先出现的为准; 位置相同时取较长的, 例如 "\r\n" 优先于 "\n"
+// Unpack 以 []byte 返回帧; Pack 在消息之后追加第一个分隔符
+type Delimiter struct {
+	Delimiters     [][]byte // 分隔符
+	StripDelimiter bool     // 解出的帧是否去掉分隔符
+	MaxLength      int      // 帧(不含分隔符)的最大长度, 超过返回 ErrFrameTooLarge, 0 表示不限
+}
+
+// 单个分隔符, 解出的帧不含分隔符
+func NewDelimiter(delimiter []byte, maxLength int) *Delimiter {
+	return &Delimiter{
+		Delimiters:     [][]byte{delimiter},
+		StripDelimiter: true,
+		MaxLength:      maxLength,
+	}
+}
+
+// 按行分帧, 以 "\n" 或 "\r\n" 结尾, 解出的帧不含行尾; Pack 追加 "\n"
+func NewLine(maxLength int) *Delimiter {
+	return &Delimiter{
+		Delimiters:     [][]byte{[]byte("\n"), []byte("\r\n")},
+		StripDelimiter: true,
+		MaxLength:      maxLength,
+	}
+}
+
+// 检查分隔符均不为空, 返回最长分隔符的长度
+func (d *Delimiter) maxDelimLen() (int, error) {
+	if len(d.Delimiters) == 0 {
+		return 0, mdgoErr.ErrInvalidDelimiter
+	}
+	max := 0
+	for _, delim := range d.Delimiters {
+		if len(delim) == 0 {
+			return 0, mdgoErr.ErrInvalidDelimiter
+		}
+		if len(delim) > max {
+			max = len(delim)
+		}
+	}
+	return max, nil
+}
+
+// 查找最先出现的分隔符, 返回帧长度和分隔符长度
+func (d *Delimiter) find(in *buffer.FixBuffer) (frameLen, delimLen int) {
+	frameLen = -1
+	for _, delim := range d.Delimiters {
+		idx := in.Index(delim)
+		if idx < 0 {
+			continue
+		}
+		if frameLen < 0 || idx < frameLen || (idx == frameLen && len(delim) > delimLen) {
+			frameLen, delimLen = idx, len(delim)
+		}
+	}
+	return
+}
+
+// 解出一个完整的帧; 数据不足时返回 nil, nil
+// 未找到分隔符但数据已超过 MaxLength 时立即返回错误, 不再等待分隔符;
+// 末尾可能是只到达了一部分的分隔符, 因此最多容忍 MaxLength + 最长分隔符长度 - 1 字节
+func (d *Delimiter) Unpack(in *buffer.FixBuffer) (interface{}, error) {
+	maxDelim, err := d.maxDelimLen()
+	if err != nil {
+		return nil, err
+	}
+
+	frameLen, delimLen := d.find(in)
+	if frameLen < 0 {
+		if d.MaxLength > 0 && in.ReadableBytes() > d.MaxLength+maxDelim-1 {
+			return nil, mdgoErr.ErrFrameTooLarge
+		}
+		return nil, nil
+	}
+	if d.MaxLength > 0 && frameLen > d.MaxLength {
+		return nil, mdgoErr.ErrFrameTooLarge
+	}
+
+	n := frameLen
+	if !d.StripDelimiter {
+		n += delimLen
+	}
+	frame := make([]byte, n)
+	copy(frame, in.Peek(frameLen+delimLen))
+	in.Retrieve(frameLen + delimLen)
+	return frame, nil
+}
+
+func (d *Delimiter) Pack(msg interface{}) ([]byte, error) {
+	if _, err := d.maxDelimLen(); err != nil {
+		return nil, err
+	}
+
+	var content []byte
+	switch m := msg.(type) {
+	case []byte:
+		content = m
+	case string:
+		content = []byte(m)
+	default:
+		return nil, mdgoErr.ErrUnsupportedMsg
+	}
+	if d.MaxLength > 0 && len(content) > d.MaxLength {
+		return nil, mdgoErr.ErrFrameTooLarge
+	}
+
+	delim := d.Delimiters[0]
+	out := make([]byte, len(content)+len(delim))
+	copy(out, content)
+	copy(out[len(content):], delim)
+	return out, nil
+}
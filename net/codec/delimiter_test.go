@@ -0,0 +1,119 @@
+package codec
+
+import (
+	"testing"
+
+	mdgoErr "github.com/aizsfgk/mdgo/net/errors"
+)
+
+func TestDelimiterUnpack(t *testing.T) {
+	tests := []struct {
+		name  string
+		codec *Delimiter
+		in    []byte
+		want  []string
+	}{
+		{
+			name:  "single delimiter",
+			codec: NewDelimiter([]byte("$$"), 0),
+			in:    []byte("hello$$$$world$$tail"),
+			want:  []string{"hello", "", "world", "<left:tail>"},
+		},
+		{
+			name:  "keep delimiter",
+			codec: &Delimiter{Delimiters: [][]byte{[]byte("|")}},
+			in:    []byte("a|bc|"),
+			want:  []string{"a|", "bc|"},
+		},
+		{
+			name:  "line lf and crlf",
+			codec: NewLine(0),
+			in:    []byte("GET /\r\nHost: x\n\r\nbody"),
+			want:  []string{"GET /", "Host: x", "", "<left:body>"},
+		},
+		{
+			name:  "earliest delimiter wins",
+			codec: &Delimiter{Delimiters: [][]byte{[]byte("b"), []byte("a")}, StripDelimiter: true},
+			in:    []byte("xaybz"),
+			want:  []string{"x", "y", "<left:z>"},
+		},
+		{
+			name:  "max length exact",
+			codec: NewLine(3),
+			in:    []byte("abc\nde\n"),
+			want:  []string{"abc", "de"},
+		},
+		{
+			name:  "max length exact crlf",
+			codec: NewLine(3),
+			in:    []byte("abc\r\nde\r\n"),
+			want:  []string{"abc", "de"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+"/coalesced", func(t *testing.T) {
+			got, err := unpackChunks(tt.codec, [][]byte{tt.in})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertFrames(t, got, tt.want)
+		})
+		t.Run(tt.name+"/byte by byte", func(t *testing.T) {
+			got, err := unpackChunks(tt.codec, splitBytes(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertFrames(t, got, tt.want)
+		})
+	}
+}
+
+func TestDelimiterUnpackError(t *testing.T) {
+	tests := []struct {
+		name  string
+		codec *Delimiter
+		in    []byte
+		err   error
+	}{
+		{"frame too large", NewLine(3), []byte("abcd\n"), mdgoErr.ErrFrameTooLarge},
+		{"no delimiter over max", NewLine(3), []byte("abcdefgh"), mdgoErr.ErrFrameTooLarge},
+		{"no delimiters", &Delimiter{}, []byte("a\n"), mdgoErr.ErrInvalidDelimiter},
+		{"empty delimiter", &Delimiter{Delimiters: [][]byte{[]byte("\n"), nil}}, []byte("a\n"), mdgoErr.ErrInvalidDelimiter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := unpackChunks(tt.codec, [][]byte{tt.in})
+			if err != tt.err {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDelimiterPack(t *testing.T) {
+	c := NewLine(4)
+	b, err := c.Pack("ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "ping\n" {
+		t.Fatalf("got %q", b)
+	}
+	if _, err := c.Pack("pong!"); err != mdgoErr.ErrFrameTooLarge {
+		t.Fatalf("got %v, want ErrFrameTooLarge", err)
+	}
+	if _, err := c.Pack(1); err != mdgoErr.ErrUnsupportedMsg {
+		t.Fatalf("got %v, want ErrUnsupportedMsg", err)
+	}
+	if _, err := NewDelimiter(nil, 0).Pack("ping"); err != mdgoErr.ErrInvalidDelimiter {
+		t.Fatalf("got %v, want ErrInvalidDelimiter", err)
+	}
+
+	got, err := unpackChunks(c, [][]byte{b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFrames(t, got, []string{"ping"})
+}
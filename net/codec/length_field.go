@@ -0,0 +1,165 @@
+package codec
+
+import (
+	"encoding/binary"
+
+	"github.com/aizsfgk/mdgo/net/buffer"
+	mdgoErr "github.com/aizsfgk/mdgo/net/errors"
+)
+
+const maxInt = int(^uint(0) >> 1)
+
+// 基于长度字段的编解码器, 参考 netty LengthFieldBasedFrameDecoder/LengthFieldPrepender
+//
+// +-------------------+-------------------+---------------------------+
+// |      header       |   length field    |          content          |
+// +-------------------+-------------------+---------------------------+
+// | LengthFieldOffset | LengthFieldLength | value + LengthAdjustment  |
+//
+// 帧长度 = LengthFieldOffset + LengthFieldLength + 长度字段的值 + LengthAdjustment
+// Unpack 去掉帧头部的 InitialBytesToStrip 个字节后, 以 []byte 返回
+type LengthField struct {
+	LengthFieldOffset   int              // 长度字段的偏移
+	LengthFieldLength   int              // 长度字段的字节数: 1/2/4/8
+	ByteOrder           binary.ByteOrder // 字节序, nil 表示大端(网络字节序)
+	LengthAdjustment    int              // 长度字段的值不是内容长度时的修正, 例如值包含了头部长度时为负数
+	InitialBytesToStrip int              // 解出的帧去掉头部的字节数
+	MaxFrameLength      int              // 帧的最大长度, 超过返回 ErrFrameTooLarge, 0 表示不限
+}
+
+// 最常用的格式: lengthFieldLength 字节大端长度 + 内容, 解出的帧不含长度字段
+func NewLengthField(lengthFieldLength, maxFrameLength int) *LengthField {
+	return &LengthField{
+		LengthFieldLength:   lengthFieldLength,
+		InitialBytesToStrip: lengthFieldLength,
+		MaxFrameLength:      maxFrameLength,
+	}
+}
+
+func (l *LengthField) byteOrder() binary.ByteOrder {
+	if l.ByteOrder == nil {
+		return binary.BigEndian
+	}
+	return l.ByteOrder
+}
+
+func (l *LengthField) check() error {
+	switch l.LengthFieldLength {
+	case 1, 2, 4, 8:
+	default:
+		return mdgoErr.ErrInvalidLenField
+	}
+	if l.LengthFieldOffset < 0 || l.InitialBytesToStrip < 0 || l.MaxFrameLength < 0 {
+		return mdgoErr.ErrInvalidLenField
+	}
+	return nil
+}
+
+func (l *LengthField) getLength(b []byte) uint64 {
+	order := l.byteOrder()
+	switch l.LengthFieldLength {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(order.Uint16(b))
+	case 4:
+		return uint64(order.Uint32(b))
+	default:
+		return order.Uint64(b)
+	}
+}
+
+func (l *LengthField) putLength(b []byte, v uint64) {
+	order := l.byteOrder()
+	switch l.LengthFieldLength {
+	case 1:
+		b[0] = byte(v)
+	case 2:
+		order.PutUint16(b, uint16(v))
+	case 4:
+		order.PutUint32(b, uint32(v))
+	default:
+		order.PutUint64(b, v)
+	}
+}
+
+// 长度字段能表示的最大值
+func (l *LengthField) maxLength() uint64 {
+	if l.LengthFieldLength == 8 {
+		return ^uint64(0)
+	}
+	return 1<<(8*uint(l.LengthFieldLength)) - 1
+}
+
+// 解出一个完整的帧; 数据不足时返回 nil, nil
+func (l *LengthField) Unpack(in *buffer.FixBuffer) (interface{}, error) {
+	if err := l.check(); err != nil {
+		return nil, err
+	}
+
+	lengthEnd := l.LengthFieldOffset + l.LengthFieldLength
+	if in.ReadableBytes() < lengthEnd {
+		return nil, nil
+	}
+	length := l.getLength(in.Peek(lengthEnd)[l.LengthFieldOffset:])
+	if length > uint64(maxInt-lengthEnd) {
+		return nil, mdgoErr.ErrFrameTooLarge
+	}
+
+	frameLen := int(length) + lengthEnd + l.LengthAdjustment
+	if frameLen < lengthEnd {
+		return nil, mdgoErr.ErrInvalidFrameLen
+	}
+	if l.MaxFrameLength > 0 && frameLen > l.MaxFrameLength {
+		return nil, mdgoErr.ErrFrameTooLarge
+	}
+	if l.InitialBytesToStrip > frameLen {
+		return nil, mdgoErr.ErrInvalidFrameLen
+	}
+	if in.ReadableBytes() < frameLen {
+		return nil, nil
+	}
+
+	frame := make([]byte, frameLen-l.InitialBytesToStrip)
+	copy(frame, in.Peek(frameLen)[l.InitialBytesToStrip:])
+	in.Retrieve(frameLen)
+	return frame, nil
+}
+
+// 在内容前加上长度字段, 长度字段的值为 len(msg) - LengthAdjustment
+// msg 为 []byte 或 string; 不支持 LengthFieldOffset 不为0的格式, 头部需由调用者自行编码
+func (l *LengthField) Pack(msg interface{}) ([]byte, error) {
+	if err := l.check(); err != nil {
+		return nil, err
+	}
+	if l.LengthFieldOffset != 0 {
+		return nil, mdgoErr.ErrInvalidLenField
+	}
+
+	var content []byte
+	switch m := msg.(type) {
+	case []byte:
+		content = m
+	case string:
+		content = []byte(m)
+	default:
+		return nil, mdgoErr.ErrUnsupportedMsg
+	}
+
+	frameLen := l.LengthFieldLength + len(content)
+	if l.MaxFrameLength > 0 && frameLen > l.MaxFrameLength {
+		return nil, mdgoErr.ErrFrameTooLarge
+	}
+	length := len(content) - l.LengthAdjustment
+	if length < 0 {
+		return nil, mdgoErr.ErrInvalidFrameLen
+	}
+	if uint64(length) > l.maxLength() {
+		return nil, mdgoErr.ErrFrameTooLarge
+	}
+
+	out := make([]byte, frameLen)
+	l.putLength(out, uint64(length))
+	copy(out[l.LengthFieldLength:], content)
+	return out, nil
+}
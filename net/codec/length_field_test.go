@@ -0,0 +1,277 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/aizsfgk/mdgo/net/buffer"
+	mdgoErr "github.com/aizsfgk/mdgo/net/errors"
+)
+
+type unpacker interface {
+	Unpack(in *buffer.FixBuffer) (interface{}, error)
+}
+
+// 依次追加 chunks, 每次追加后解出所有完整的帧
+func unpackChunks(c unpacker, chunks [][]byte) (frames []string, err error) {
+	in := buffer.NewFixBuffer()
+	for _, chunk := range chunks {
+		in.Append(chunk)
+		for {
+			msg, err := c.Unpack(in)
+			if err != nil {
+				return frames, err
+			}
+			if msg == nil {
+				break
+			}
+			frames = append(frames, string(msg.([]byte)))
+		}
+	}
+	if in.ReadableBytes() != 0 {
+		frames = append(frames, "<left:"+string(in.PeekAll())+">")
+	}
+	return frames, nil
+}
+
+// 按单字节切分, 模拟最极端的部分读
+func splitBytes(b []byte) [][]byte {
+	chunks := make([][]byte, len(b))
+	for i := range b {
+		chunks[i] = b[i : i+1]
+	}
+	return chunks
+}
+
+func TestLengthFieldUnpack(t *testing.T) {
+	tests := []struct {
+		name  string
+		codec LengthField
+		in    []byte
+		want  []string
+	}{
+		{
+			name:  "1 byte length",
+			codec: LengthField{LengthFieldLength: 1, InitialBytesToStrip: 1},
+			in:    []byte("\x05hello\x00\x02go"),
+			want:  []string{"hello", "", "go"},
+		},
+		{
+			name:  "2 bytes big endian keep length field",
+			codec: LengthField{LengthFieldLength: 2},
+			in:    []byte("\x00\x03abc\x00\x01d"),
+			want:  []string{"\x00\x03abc", "\x00\x01d"},
+		},
+		{
+			name:  "4 bytes little endian",
+			codec: LengthField{LengthFieldLength: 4, ByteOrder: binary.LittleEndian, InitialBytesToStrip: 4},
+			in:    []byte("\x03\x00\x00\x00abc\x02\x00\x00\x00de"),
+			want:  []string{"abc", "de"},
+		},
+		{
+			name:  "8 bytes",
+			codec: LengthField{LengthFieldLength: 8, InitialBytesToStrip: 8},
+			in:    []byte("\x00\x00\x00\x00\x00\x00\x00\x04mdgo"),
+			want:  []string{"mdgo"},
+		},
+		{
+			name:  "length includes length field",
+			codec: LengthField{LengthFieldLength: 2, LengthAdjustment: -2, InitialBytesToStrip: 2},
+			in:    []byte("\x00\x05abc\x00\x02"),
+			want:  []string{"abc", ""},
+		},
+		{
+			name:  "header before length field",
+			codec: LengthField{LengthFieldOffset: 2, LengthFieldLength: 2, InitialBytesToStrip: 0},
+			in:    []byte("\xca\xfe\x00\x02hi"),
+			want:  []string{"\xca\xfe\x00\x02hi"},
+		},
+		{
+			name:  "header after length field",
+			codec: LengthField{LengthFieldLength: 1, LengthAdjustment: 2, InitialBytesToStrip: 1},
+			in:    []byte("\x02\x01\x01ok"),
+			want:  []string{"\x01\x01ok"},
+		},
+		{
+			name:  "incomplete frame stays buffered",
+			codec: LengthField{LengthFieldLength: 2, InitialBytesToStrip: 2},
+			in:    []byte("\x00\x02ab\x00\x05abc"),
+			want:  []string{"ab", "<left:\x00\x05abc>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+"/coalesced", func(t *testing.T) {
+			got, err := unpackChunks(&tt.codec, [][]byte{tt.in})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertFrames(t, got, tt.want)
+		})
+		t.Run(tt.name+"/partial", func(t *testing.T) {
+			got, err := unpackChunks(&tt.codec, splitBytes(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertFrames(t, got, tt.want)
+		})
+	}
+}
+
+func assertFrames(t *testing.T, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("frame %d: got %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestLengthFieldUnpackError(t *testing.T) {
+	tests := []struct {
+		name  string
+		codec LengthField
+		in    []byte
+		want  error
+	}{
+		{
+			name:  "frame too large",
+			codec: LengthField{LengthFieldLength: 2, InitialBytesToStrip: 2, MaxFrameLength: 10},
+			in:    []byte("\x00\x09"),
+			want:  mdgoErr.ErrFrameTooLarge,
+		},
+		{
+			name:  "huge 8 bytes length",
+			codec: LengthField{LengthFieldLength: 8},
+			in:    []byte("\xff\xff\xff\xff\xff\xff\xff\xff"),
+			want:  mdgoErr.ErrFrameTooLarge,
+		},
+		{
+			name:  "negative frame length",
+			codec: LengthField{LengthFieldLength: 1, LengthAdjustment: -4},
+			in:    []byte("\x02"),
+			want:  mdgoErr.ErrInvalidFrameLen,
+		},
+		{
+			name:  "strip more than frame",
+			codec: LengthField{LengthFieldLength: 1, InitialBytesToStrip: 5},
+			in:    []byte("\x01a"),
+			want:  mdgoErr.ErrInvalidFrameLen,
+		},
+		{
+			name:  "invalid length field length",
+			codec: LengthField{LengthFieldLength: 3},
+			in:    []byte("\x00\x00\x01a"),
+			want:  mdgoErr.ErrInvalidLenField,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 超长在长度字段到达时即可发现, 无需等待内容
+			_, err := unpackChunks(&tt.codec, splitBytes(tt.in))
+			if err != tt.want {
+				t.Fatalf("got err %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLengthFieldPack(t *testing.T) {
+	tests := []struct {
+		name  string
+		codec LengthField
+		msg   interface{}
+		want  []byte
+		err   error
+	}{
+		{
+			name:  "2 bytes",
+			codec: *NewLengthField(2, 0),
+			msg:   "hello",
+			want:  []byte("\x00\x05hello"),
+		},
+		{
+			name:  "4 bytes little endian",
+			codec: LengthField{LengthFieldLength: 4, ByteOrder: binary.LittleEndian},
+			msg:   []byte("ab"),
+			want:  []byte("\x02\x00\x00\x00ab"),
+		},
+		{
+			name:  "length includes length field",
+			codec: LengthField{LengthFieldLength: 2, LengthAdjustment: -2},
+			msg:   "abc",
+			want:  []byte("\x00\x05abc"),
+		},
+		{
+			name:  "overflow length field",
+			codec: LengthField{LengthFieldLength: 1},
+			msg:   string(make([]byte, 256)),
+			err:   mdgoErr.ErrFrameTooLarge,
+		},
+		{
+			name:  "over max frame length",
+			codec: LengthField{LengthFieldLength: 1, MaxFrameLength: 4},
+			msg:   "abcd",
+			err:   mdgoErr.ErrFrameTooLarge,
+		},
+		{
+			name:  "unsupported message",
+			codec: LengthField{LengthFieldLength: 1},
+			msg:   1,
+			err:   mdgoErr.ErrUnsupportedMsg,
+		},
+		{
+			name:  "offset not supported",
+			codec: LengthField{LengthFieldOffset: 1, LengthFieldLength: 1},
+			msg:   "a",
+			err:   mdgoErr.ErrInvalidLenField,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.codec.Pack(tt.msg)
+			if err != tt.err {
+				t.Fatalf("got err %v, want %v", err, tt.err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLengthFieldRoundTrip(t *testing.T) {
+	c := NewLengthField(4, 1<<20)
+	var stream []byte
+	msgs := []string{"", "a", string(bytes.Repeat([]byte("x"), 5000)), "end"}
+	for _, m := range msgs {
+		b, err := c.Pack(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream = append(stream, b...)
+	}
+
+	// 以不同大小切分, 覆盖帧跨越多次读取的情况
+	for _, size := range []int{1, 3, 1024, len(stream)} {
+		var chunks [][]byte
+		for i := 0; i < len(stream); i += size {
+			end := i + size
+			if end > len(stream) {
+				end = len(stream)
+			}
+			chunks = append(chunks, stream[i:end])
+		}
+		got, err := unpackChunks(c, chunks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertFrames(t, got, msgs)
+	}
+}
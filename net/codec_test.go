@@ -0,0 +1,164 @@
+package net
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aizsfgk/mdgo/net/buffer"
+	"github.com/aizsfgk/mdgo/net/codec"
+	mdgoErr "github.com/aizsfgk/mdgo/net/errors"
+)
+
+var errZeroLength = errors.New("zero length frame")
+
+// 测试用编解码器: 1字节长度 + 内容
+type byteLenCodec struct{}
+
+func (byteLenCodec) Pack(msg interface{}) ([]byte, error) {
+	s, ok := msg.(string)
+	if !ok {
+		return nil, mdgoErr.ErrUnsupportedMsg
+	}
+	return append([]byte{byte(len(s))}, s...), nil
+}
+
+func (byteLenCodec) Unpack(in *buffer.FixBuffer) (interface{}, error) {
+	if in.ReadableBytes() < 1 {
+		return nil, nil
+	}
+	n := int(in.PeekUint8())
+	if n == 0 {
+		return nil, errZeroLength
+	}
+	if in.ReadableBytes() < 1+n {
+		return nil, nil
+	}
+	in.Retrieve(1)
+	return string(in.RetrieveAsBytes(n)), nil
+}
+
+type frameTestHandler struct {
+	testHandler
+	onFrame      func(conn *Connection, msg interface{})
+	onCodecError func(conn *Connection, err error)
+}
+
+func (h *frameTestHandler) OnFrame(conn *Connection, msg interface{}) {
+	h.onFrame(conn, msg)
+}
+
+func (h *frameTestHandler) OnCodecError(conn *Connection, err error) {
+	if h.onCodecError != nil {
+		h.onCodecError(conn, err)
+	}
+}
+
+func TestServerCodecFrames(t *testing.T) {
+	frames := make(chan string, 16)
+	serv := startTestServer(t, &frameTestHandler{
+		onFrame: func(conn *Connection, msg interface{}) {
+			frames <- msg.(string)
+			_ = conn.Write("re:" + msg.(string))
+		},
+	}, WithCodec(byteLenCodec{}))
+
+	cli, err := net.Dial("tcp", serv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	// 不完整的帧: 分多次到达
+	for _, part := range []string{"\x05he", "l", "lo"} {
+		if _, err = cli.Write([]byte(part)); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	// 多个帧一次到达
+	if _, err = cli.Write([]byte("\x01a\x02bc\x03def")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"hello", "a", "bc", "def"} {
+		select {
+		case got := <-frames:
+			if got != want {
+				t.Fatalf("got frame %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("frame %q is not received", want)
+		}
+	}
+
+	want := "\x08re:hello\x04re:a\x05re:bc\x06re:def"
+	got := make([]byte, len(want))
+	_ = cli.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err = io.ReadFull(cli, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestServerCodecErrorClose(t *testing.T) {
+	codecErr := make(chan error, 1)
+	serv := startTestServer(t, &frameTestHandler{
+		onFrame: func(conn *Connection, msg interface{}) {},
+		onCodecError: func(conn *Connection, err error) {
+			codecErr <- err
+		},
+	}, WithCodec(byteLenCodec{}))
+
+	cli, err := net.Dial("tcp", serv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	if _, err = cli.Write([]byte{0}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-codecErr:
+		if err != errZeroLength {
+			t.Fatalf("got err %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnCodecError is not called")
+	}
+
+	_ = cli.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var b [1]byte
+	if _, err = cli.Read(b[:]); err != io.EOF {
+		t.Fatalf("read err: %v, want EOF", err)
+	}
+}
+
+func TestServerCodecRequiresFrameCallback(t *testing.T) {
+	_, err := NewServer(&testHandler{}, Addr("127.0.0.1:0"), WithCodec(codec.Default{}))
+	if err != mdgoErr.ErrNoFrameCallback {
+		t.Fatalf("got err %v, want %v", err, mdgoErr.ErrNoFrameCallback)
+	}
+}
+
+func TestConnectionWriteWithoutCodec(t *testing.T) {
+	connCh := make(chan *Connection, 1)
+	serv := startTestServer(t, &testHandler{
+		onConnection: func(conn *Connection) { connCh <- conn },
+	})
+	cli, err := net.Dial("tcp", serv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	conn := <-connCh
+	if err = conn.Write("x"); err != mdgoErr.ErrCodecIsNil {
+		t.Fatalf("got err %v, want %v", err, mdgoErr.ErrCodecIsNil)
+	}
+}
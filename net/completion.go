@@ -0,0 +1,210 @@
+package net
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/aizsfgk/mdgo/net/buffer"
+	"github.com/aizsfgk/mdgo/net/event"
+)
+
+// 完成式 I/O(io_uring): 连接的读写及监听套接字的 accept 作为请求提交给轮询器,
+// 完成后由 Poll 返回, 不再等待就绪后自己读写
+// 每个连接至多一个未完成的读和一个未完成的写; 提交的请求在下一次 Poll 时与等待一起提交
+
+// 一次 sendmsg 最多的 iovec 个数
+const completionIovMax = 64
+
+// 以完成式 I/O 注册的套接字
+type completionContext interface {
+	SocketContext
+	handleCompletion(ev *event.EventHolder, nowUnix int64) error
+}
+
+// 完成事件, 在事件循环中执行
+func (conn *Connection) handleCompletion(ev *event.EventHolder, nowUnix int64) error {
+	conn.activeTime.Swap(nowUnix)
+	if conn.idleWheel != nil {
+		conn.idleWheel.touch(conn)
+	}
+
+	var err error
+	switch ev.Op {
+	case event.OpRecv:
+		conn.recving = false
+		err = conn.handleRecv(ev.Res, ev.Data, nowUnix)
+	case event.OpSend:
+		conn.sending = false
+		err = conn.handleSent(ev.Res)
+	case event.OpWritable:
+		conn.sending = false
+		err = conn.submit()
+	}
+
+	// 等待请求结束后开始转发
+	if p := conn.pipeWait; p != nil && conn.connected.Get() {
+		p.tryStart()
+	}
+	return err
+}
+
+// 读完成: 数据追加到 InBuf 后回调, 然后继续读
+// 暂停读取或等待转发时数据留在 InBuf 中, 恢复读取或开始转发时处理
+func (conn *Connection) handleRecv(res int, data []byte, nowUnix int64) error {
+	if res < 0 {
+		switch errno := syscall.Errno(-res); errno {
+		case syscall.ECANCELED:
+			return nil
+		case syscall.EAGAIN, syscall.EINTR:
+			return conn.submit()
+		default:
+			conn.eventLoop.logger.Debugf("fd %d: recv err: %v", conn.Fd(), errno)
+			return conn.handleClose()
+		}
+	}
+	if res == 0 {
+		return conn.handleClose()
+	}
+
+	conn.InBuf.Append(data)
+	if !conn.readPaused && conn.pipeWait == nil {
+		conn.handleMessage(nowUnix)
+	}
+	// 数据先读到轮询器的缓冲, InBuf 只保存未处理的数据, 处理完后恢复默认大小
+	if conn.connected.Get() && conn.InBuf.ReadableBytes() == 0 && conn.InBuf.Cap() > buffer.DefaultSize {
+		nf := buffer.Get(buffer.DefaultSize)
+		conn.InBuf.Swap(nf)
+		buffer.Put(nf)
+	}
+	return conn.submit()
+}
+
+// 写完成: 丢弃已写出的数据, 写完时回调 OnWriteComplete, 否则继续写
+func (conn *Connection) handleSent(res int) error {
+	for i := range conn.iov {
+		conn.iov[i] = syscall.Iovec{}
+	}
+	if res < 0 {
+		switch errno := syscall.Errno(-res); errno {
+		case syscall.ECANCELED:
+			return nil
+		case syscall.EAGAIN, syscall.EINTR:
+			return conn.submit()
+		default:
+			conn.eventLoop.logger.Debugf("fd %d: send err: %v", conn.Fd(), errno)
+			return conn.handleClose()
+		}
+	}
+
+	conn.OutBuf.Retrieve(res)
+	if err := conn.writeDone(); err != nil {
+		return err
+	}
+	return conn.submit()
+}
+
+// 按关注的事件提交读写请求, 已有未完成的请求时不重复提交, 需在事件循环中调用
+// 关注写事件且输出缓冲不空时写
+func (conn *Connection) submit() error {
+	if !conn.connected.Get() || conn.pipeWait != nil {
+		return nil
+	}
+	if conn.events&event.EventRead != 0 && !conn.recving {
+		if err := conn.eventLoop.completion.Recv(conn.Fd()); err != nil {
+			return err
+		}
+		conn.recving = true
+	}
+	if conn.events&event.EventWrite != 0 && !conn.sending && conn.OutBuf.ReadableBytes() > 0 {
+		return conn.send()
+	}
+	return nil
+}
+
+// 写出输出缓冲: 内存块通过 sendmsg 提交; 文件块直接 sendfile, 写满时等待可写
+func (conn *Connection) send() error {
+	fd := conn.Fd()
+	for conn.OutBuf.HeadIsFile() {
+		_, errno := conn.OutBuf.WriteFd(fd, conn.eventLoop.iovecs)
+		if errno == syscall.EAGAIN {
+			conn.sending = true
+			return conn.eventLoop.completion.WaitWritable(fd)
+		}
+		if errno != 0 {
+			return conn.handleClose()
+		}
+	}
+	if conn.OutBuf.ReadableBytes() == 0 {
+		return conn.writeDone()
+	}
+
+	if conn.iov == nil {
+		conn.iov = make([]syscall.Iovec, completionIovMax)
+	}
+	n := conn.OutBuf.Iovecs(conn.iov)
+	conn.msg.Iov = &conn.iov[0]
+	// msg_iovlen 为 size_t, 与 uintptr 等长
+	*(*uintptr)(unsafe.Pointer(&conn.msg.Iovlen)) = uintptr(n)
+	if err := conn.eventLoop.completion.Sendmsg(fd, &conn.msg); err != nil {
+		return err
+	}
+	conn.sending = true
+	return nil
+}
+
+// 取消未完成的读, 用于转为就绪通知
+func (conn *Connection) cancelRecv() {
+	if !conn.recving {
+		return
+	}
+	if err := conn.eventLoop.completion.CancelRecv(conn.Fd()); err != nil {
+		conn.eventLoop.logger.Errorf("fd %d: cancel recv err: %v", conn.Fd(), err)
+	}
+}
+
+// 没有未完成的请求时, 从完成式 I/O 转为就绪通知, 之后由 setEvents 重新注册
+func (conn *Connection) toReadiness() error {
+	if !conn.completion {
+		return nil
+	}
+	conn.completion = false
+	conn.events = event.EventNone
+	return conn.eventLoop.Poll.Del(conn.Fd())
+}
+
+// 以完成式 I/O 注册监听套接字, 并提交 accept 请求
+func (l *Listener) registerCompletion() error {
+	if err := l.loop.AddSocketCompletion(l.listenFd, l); err != nil {
+		return err
+	}
+	return l.loop.completion.Accept(l.listenFd)
+}
+
+// accept 完成: 继续接收下一个连接, 然后处理新连接
+func (l *Listener) handleCompletion(ev *event.EventHolder, nowUnix int64) error {
+	if ev.Res < 0 && syscall.Errno(-ev.Res) == syscall.ECANCELED {
+		return nil
+	}
+	if err := l.loop.completion.Accept(l.listenFd); err != nil {
+		if ev.Res >= 0 {
+			_ = syscall.Close(ev.Res)
+		}
+		return err
+	}
+	if ev.Res < 0 {
+		if errno := syscall.Errno(-ev.Res); errno != syscall.EAGAIN && errno != syscall.EINTR {
+			return errno
+		}
+		return nil
+	}
+
+	connFd := ev.Res
+	// 对端可能已经重置连接
+	sa, err := syscall.Getpeername(connFd)
+	if err != nil {
+		_ = syscall.Close(connFd)
+		return err
+	}
+	l.loop.logger.Debugf("listener fd %d: accept fd: %d", l.listenFd, connFd)
+	return l.handleNewConn(connFd, sa)
+}
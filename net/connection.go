@@ -21,27 +21,76 @@ type Callback interface {
 	OnWriteComplete()
 }
 
+// 可选回调: 设置了编解码器时, 每解出一个完整的帧调用一次
+type FrameCallback interface {
+	OnFrame(conn *Connection, msg interface{})
+}
+
+// 可选回调: 解码出错, 回调之后连接会被关闭
+type CodecErrorCallback interface {
+	OnCodecError(conn *Connection, err error)
+}
+
+// 可选回调: 连接空闲超时
+// 返回 true 表示保留连接(例如已发送心跳), 并重新计时; 返回 false 则关闭连接
+type IdleCallback interface {
+	OnIdle(conn *Connection) bool
+}
+
+// 可选回调: 输出缓冲达到高水位(Option.HighWaterMark), 从低于高水位变为达到时调用一次
+// 通常在此暂停读取数据来源的连接(StopRead), 避免输出缓冲无限增长
+type HighWaterMarkCallback interface {
+	OnHighWaterMark(conn *Connection, queued int)
+}
+
+// 可选回调: 达到高水位之后, 输出缓冲降至低水位(Option.LowWaterMark)及以下时调用一次
+// 通常在此恢复读取(StartRead)
+type LowWaterMarkCallback interface {
+	OnLowWaterMark(conn *Connection, queued int)
+}
+
 // 定义连接
 type Connection struct {
-	connFd     int               // acceptFd
-	connected  atomic.Bool       // state[connected or not]
-	InBuf      *buffer.FixBuffer // input buffer
-	OutBuf     *buffer.FixBuffer // output buffer
-	cb         Callback          // cb
-	peerAddr   string            // remote addr
-	eventLoop  *EventLoop        // work sub eventLoop
-	activeTime atomic.Int64      // last active time
+	connFd        int                 // acceptFd
+	connected     atomic.Bool         // state[connected or not]
+	InBuf         *buffer.FixBuffer   // input buffer, returned to pool after close
+	OutBuf        *buffer.ChainBuffer // output queue, released after close
+	cb            Callback            // cb
+	peerAddr      string              // remote addr
+	eventLoop     *EventLoop          // work sub eventLoop
+	activeTime    atomic.Int64        // last active time
+	idleWheel     *timingWheel        // idle timeout, nil if disabled
+	wheelSlot     int                 // slot in idleWheel
+	codec         Codec               // codec, nil if raw OnMessage
+	frameCb       FrameCallback       // frame callback, set with codec
+	closing       bool                // close after OutBuf is flushed
+	closeCb       func(*Connection)   // internal close callback, set by owner
+	events        event.Event         // events registered in poller
+	pipe          *Pipe               // splice to another connection, nil if not piped
+	readPaused    bool                // StopRead is called
+	highWater     int                 // OutBuf high-water mark, 0 if disabled
+	lowWater      int                 // OutBuf low-water mark
+	aboveHigh     bool                // OutBuf reached highWater and not drained to lowWater
+	edgeTriggered bool                // registered with EPOLLET
+	completion    bool                // reads/writes are submitted to the poller (io_uring)
+	recving       bool                // completion: recv is in flight
+	sending       bool                // completion: sendmsg or wait-writable is in flight
+	msg           syscall.Msghdr      // completion: in-flight sendmsg
+	iov           []syscall.Iovec     // completion: iovecs of msg
+	pipeWait      *Pipe               // completion: pipe to start when no request is in flight
 }
 
 // 新建连接
 func NewConnection(fd int, loop *EventLoop, sa syscall.Sockaddr, cb Callback) (*Connection, error) {
 	conn := &Connection{
 		connFd:    fd,
-		InBuf:     buffer.NewFixBuffer(),
-		OutBuf:    buffer.NewFixBuffer(),
+		InBuf:     buffer.Get(buffer.DefaultSize),
+		OutBuf:    buffer.NewChainBuffer(),
 		peerAddr:  sockAddrToString(sa),
 		eventLoop: loop,
 		cb:        cb,
+		wheelSlot: -1,
+		events:    event.EventRead, // 由 AddSocketAndEnableRead 注册
 	}
 	conn.connected.Set(true)
 	return conn, nil
@@ -55,20 +104,48 @@ func NewConnection(fd int, loop *EventLoop, sa syscall.Sockaddr, cb Callback) (*
 //	conn.cb.OnClose = msgCb
 //}
 
+func (conn *Connection) setCodec(c Codec) {
+	conn.codec = c
+	if c != nil {
+		conn.frameCb, _ = conn.cb.(FrameCallback)
+	}
+}
+
+func (conn *Connection) setWaterMarks(high, low int) {
+	conn.highWater, conn.lowWater = high, low
+}
+
 func (conn *Connection) Fd() int {
 	return conn.connFd
 }
 
+// 所属事件循环
+func (conn *Connection) Loop() *EventLoop {
+	return conn.eventLoop
+}
+
+// 对端地址
+func (conn *Connection) PeerAddr() string {
+	return conn.peerAddr
+}
+
 //
 // export api func
 //
 
 // close
+// 可以在任意协程中调用, 非本循环协程调用时, 关闭动作在事件循环中异步执行
 func (conn *Connection) Close() error {
 	if !conn.connected.Get() {
 		return mdgoErr.ErrConnectionClosed
 	}
-	return conn.handleClose()
+	if conn.eventLoop.IsInLoop() {
+		return conn.handleClose()
+	}
+	conn.eventLoop.QueueInLoop(func() {
+		_ = conn.handleClose()
+	})
+	return nil
 }
 
 // send
@@ -85,72 +162,209 @@ func (conn *Connection) SendByte(out []byte) error {
 	return nil
 }
 
+// 发送数据, 可以在任意协程中调用
+// 非本循环协程调用时, 拷贝数据后投递到事件循环中发送
+// 同一协程多次调用 Send, 数据按调用顺序发送
+func (conn *Connection) Send(out []byte) error {
+	if !conn.connected.Get() {
+		return mdgoErr.ErrConnectionClosed
+	}
+	if conn.eventLoop.IsInLoop() {
+		return conn.sendInLoop(out)
+	}
+
+	// 调用者可能复用 out, 拷贝后交给连接, 入队时不再拷贝
+	data := make([]byte, len(out))
+	copy(data, out)
+	conn.eventLoop.QueueInLoop(func() {
+		_ = conn.writeInLoop(data, true, nil)
+	})
+	return nil
+}
+
+// 发送 b 且不拷贝, 可以在任意协程中调用
+// 调用后 b 归连接所有, done 被调用前不可修改; 适合发送大块数据
+// done 在 b 全部写入内核后以 nil 调用, 连接关闭未能发完时以 ErrConnectionClosed 调用;
+// done 在事件循环中执行, 可以为 nil. SendOwned 直接返回 ErrConnectionClosed 时不会调用 done
+func (conn *Connection) SendOwned(b []byte, done func(err error)) error {
+	if !conn.connected.Get() {
+		return mdgoErr.ErrConnectionClosed
+	}
+	if conn.eventLoop.IsInLoop() {
+		return conn.writeInLoop(b, true, done)
+	}
+	conn.eventLoop.QueueInLoop(func() {
+		_ = conn.writeInLoop(b, true, done)
+	})
+	return nil
+}
+
+// 使用编解码器编码后发送, 可以在任意协程中调用
+func (conn *Connection) Write(msg interface{}) error {
+	if conn.codec == nil {
+		return mdgoErr.ErrCodecIsNil
+	}
+	out, err := conn.codec.Pack(msg)
+	if err != nil {
+		return err
+	}
+	return conn.Send(out)
+}
+
+// 发送文件 f 中 [offset, offset+length) 的数据, 可以在任意协程中调用
+// 排在之前发送的数据之后, 在写事件中通过 sendfile 发送, 数据不经过用户态;
+// 输出队列发完后回调 OnWriteComplete, 在此之前 f 不可关闭
+func (conn *Connection) SendFile(f *os.File, offset, length int64) error {
+	if !conn.connected.Get() {
+		return mdgoErr.ErrConnectionClosed
+	}
+	if conn.eventLoop.IsInLoop() {
+		return conn.sendFileInLoop(f, offset, length)
+	}
+	conn.eventLoop.QueueInLoop(func() {
+		_ = conn.sendFileInLoop(f, offset, length)
+	})
+	return nil
+}
+
+func (conn *Connection) sendFileInLoop(f *os.File, offset, length int64) error {
+	if !conn.connected.Get() {
+		return mdgoErr.ErrConnectionClosed
+	}
+	if length <= 0 {
+		return nil
+	}
+
+	if conn.pipe != nil || conn.pipeWait != nil {
+		return mdgoErr.ErrConnectionPiped
+	}
+
+	queued := conn.OutBuf.ReadableBytes() > 0
+	if err := conn.OutBuf.AppendFile(f, offset, length, nil); err != nil {
+		return err
+	}
+	conn.checkHighWater()
+	if !queued {
+		// 边缘触发下套接字已可写时不会再通知, 直接发送
+		if conn.edgeTriggered {
+			return conn.handleWrite(conn.Fd())
+		}
+		return conn.setEvents(conn.events | event.EventWrite)
+	}
+	return nil
+}
 
 // 直接写回
 // 如果输出缓冲不是空
 // TODO 或者正在关注写事件，则追加数据
-func (conn *Connection) Send(out []byte) (rerr error) {
-	if conn.OutBuf.ReadableBytes() > 0 {
-		conn.OutBuf.Append(out)
-	} else {
-		n, err := syscall.Write(conn.Fd(), out)
+func (conn *Connection) sendInLoop(out []byte) error {
+	return conn.writeInLoop(out, false, nil)
+}
+
+// owned 为 true 时 out 归连接所有, 未写完的部分直接入队, 不再拷贝
+// done 在 out 全部写出或被丢弃时调用
+func (conn *Connection) writeInLoop(out []byte, owned bool, done func(err error)) (rerr error) {
+	// 投递到事件循环期间, 连接可能已经关闭
+	if !conn.connected.Get() {
+		if done != nil {
+			done(mdgoErr.ErrConnectionClosed)
+		}
+		return mdgoErr.ErrConnectionClosed
+	}
+	// 内核管道中可能有待转发的数据, 不能插入
+	if conn.pipe != nil || conn.pipeWait != nil {
+		if done != nil {
+			done(mdgoErr.ErrConnectionPiped)
+		}
+		return mdgoErr.ErrConnectionPiped
+	}
+
+	// 输出队列不空时直接排队, 保证顺序; 完成式 I/O 下排队后提交写请求
+	queued := conn.OutBuf.ReadableBytes() > 0
+	n := 0
+	if !queued && !conn.completion {
+		var err error
+		n, err = syscall.Write(conn.Fd(), out)
 		if err != nil {
 			// EAGAIN 说明没有数据空间，可以写入
 			// n个字节追加到缓冲区
 			/*
-			普通做法：
-			当需要向socket写数据时，将该socket加入到epoll等待可写事件。接收到socket可写事件后，调用write()或send()发送数据，当数据全部写完后， 将socket描述符移出epoll列表，这种做法需要反复添加和删除。
+				普通做法：
+				当需要向socket写数据时，将该socket加入到epoll等待可写事件。接收到socket可写事件后，调用write()或send()发送数据，当数据全部写完后， 将socket描述符移出epoll列表，这种做法需要反复添加和删除。
 
-			改进做法:
-			向socket写数据时直接调用send()发送，当send()返回错误码EAGAIN，才将socket加入到epoll，等待可写事件后再发送数据，全部数据发送完毕，再移出epoll模型，改进的做法相当于认为socket在大部分时候是可写的，不能写了再让epoll帮忙监控。上面两种做法是对LT模式下write事件频繁通知的修复，本质上ET模式就可以直接搞定，并不需要用户层程序的补丁操作。
+				改进做法:
+				向socket写数据时直接调用send()发送，当send()返回错误码EAGAIN，才将socket加入到epoll，等待可写事件后再发送数据，全部数据发送完毕，再移出epoll模型，改进的做法相当于认为socket在大部分时候是可写的，不能写了再让epoll帮忙监控。上面两种做法是对LT模式下write事件频繁通知的修复，本质上ET模式就可以直接搞定，并不需要用户层程序的补丁操作。
 			*/
 			if err != syscall.EAGAIN {
+				if done != nil {
+					done(mdgoErr.ErrConnectionClosed)
+				}
 				rerr = conn.handleClose()
 				return
 			}
-			fmt.Println("write fd err: ", err)
+			n = 0
 		}
+	}
 
-		// some condition, append bytes to out buffer
-		if n < len(out) {
-			fmt.Println("write fd, n: ", n)
-			if n == 0 {
-				conn.OutBuf.Append(out)
-			} else {
-				conn.OutBuf.Append(out[n:])
-			}
+	if n == len(out) {
+		if done != nil {
+			done(nil)
 		}
+		return nil
+	}
 
-		// if out buffer has readable byte, enable fd write event
-		if conn.OutBuf.ReadableBytes() > 0 {
-			return conn.eventLoop.EnableReadWrite(conn.Fd())
+	// some condition, append bytes to out buffer
+	if owned {
+		conn.OutBuf.AppendOwned(out[n:], done)
+	} else {
+		conn.OutBuf.Append(out[n:])
+		if done != nil {
+			done(nil)
 		}
 	}
+	conn.checkHighWater()
+
+	// out buffer becomes non-empty, enable fd write event
+	if !queued {
+		return conn.setEvents(conn.events | event.EventWrite)
+	}
 	return nil
 }
 
 // ********* handle Event *********** //
 func (conn *Connection) HandleEvent(eve event.Event, nowUnix int64) error {
-	conn.activeTime.Swap(time.Now().Unix())
+	conn.activeTime.Swap(nowUnix)
+	if conn.idleWheel != nil {
+		conn.idleWheel.touch(conn)
+	}
+	if conn.pipe != nil {
+		conn.pipe.handleEvent(conn, eve)
+		return nil
+	}
 
 	var err error
-	if eve&event.EventError != 0 {
-		conn.handleError(conn.Fd())
-		// TODO close conn
+	// 套接字出错时连接已不可用, 直接关闭; 没有错误时照常处理同时到达的读写事件
+	if eve&event.EventError != 0 && conn.handleError(conn.Fd()) != nil {
+		return conn.handleClose()
 	}
 
-	if eve&event.EventRead != 0 {
+	// 同一轮就绪事件中可能已调用 StopRead
+	if eve&event.EventRead != 0 && !conn.readPaused {
 		err = conn.handleRead(nowUnix)
 		if err != nil {
-			fmt.Println("handleRead-err: ", err)
+			conn.eventLoop.logger.Debugf("fd %d: handleRead err: %v", conn.Fd(), err)
 			return err
 		}
+		// 读事件中连接已关闭, fd 可能已被复用
+		if !conn.connected.Get() {
+			return nil
+		}
 	}
 
 	if eve&event.EventWrite != 0 {
 		err = conn.handleWrite(conn.Fd())
 		if err != nil {
-			fmt.Println("handleWrite-err: ", err)
+			conn.eventLoop.logger.Debugf("fd %d: handleWrite err: %v", conn.Fd(), err)
 			return err
 		}
 	}
@@ -165,24 +379,32 @@ func (conn *Connection) HandleEvent(eve event.Event, nowUnix int64) error {
  *   因为此时：接收缓冲区中一直有数据，水平触发下，需要一直通知
  */
 func (conn *Connection) handleRead(nowUnix int64) error {
+	// 边缘触发下需读到 EAGAIN 或 EOF, 否则剩余数据不会再通知;
+	// 未读满时也要继续读, 数据与 FIN 同时到达时只通知一次, 之后不会再有读事件
+	for {
+		// 等待几秒返回
+		n, err := conn.InBuf.ReadFd(conn.Fd(), conn.eventLoop.extraBuf)
+		if err.Temporary() { // 非阻塞会返回EAGAIN: resource temporarily unavailable
+			return nil
+		}
 
-	// 等待几秒返回
-	n, err := conn.InBuf.ReadFd(conn.Fd())
-	if err.Temporary() { // 非阻塞会返回EAGAIN: resource temporarily unavailable
-		return nil
-	}
-
-	if n > 0 {
-		// cb 2
-		// messageCallback回调使用
-		conn.cb.OnMessage(conn, nowUnix)
+		if n > 0 {
+			conn.handleMessage(nowUnix)
+		} else if n == 0 {
 
-	} else if n == 0 {
+			// 处理 RDHUP事件
+			_ = conn.handleClose()
+			return nil
+		} else {
+			// 读出错(如 ECONNRESET), 连接已不可用; 边缘触发下也不会再通知, 直接关闭
+			conn.eventLoop.logger.Debugf("fd %d: read err: %v", conn.Fd(), err)
+			_ = conn.handleClose()
+			return nil
+		}
 
-		// 处理 RDHUP事件
-		_ = conn.handleClose()
-	} else {
-		conn.handleError(conn.Fd())
+		if !conn.edgeTriggered || !conn.connected.Get() || conn.readPaused {
+			break
+		}
 	}
 
 	// 读取数据
@@ -194,86 +416,354 @@ func (conn *Connection) handleRead(nowUnix int64) error {
 	return nil
 }
 
+// 把 InBuf 中的数据交给编解码器或 OnMessage
+func (conn *Connection) handleMessage(nowUnix int64) {
+	// cb 2
+	// messageCallback回调使用
+	if conn.codec != nil {
+		conn.handleFrames()
+	} else {
+		conn.cb.OnMessage(conn, nowUnix)
+	}
+	if conn.connected.Get() && conn.InBuf.ReadableBytes() == 0 {
+		conn.InBuf.Shrink()
+	}
+}
+
+// 解出所有完整的帧, 不完整的帧留在 InBuf 中等待更多数据
+func (conn *Connection) handleFrames() {
+	for conn.connected.Get() {
+		msg, err := conn.codec.Unpack(conn.InBuf)
+		if err != nil {
+			conn.eventLoop.logger.Warnf("fd %d: unpack err: %v, peer: %s", conn.Fd(), err, conn.PeerAddr())
+			if cb, ok := conn.cb.(CodecErrorCallback); ok {
+				cb.OnCodecError(conn, err)
+			}
+			_ = conn.handleClose()
+			return
+		}
+		if msg == nil {
+			return
+		}
+		conn.frameCb.OnFrame(conn, msg)
+	}
+}
+
 // 2. 处理写
 // ??? 何时激活读写
-//
 func (conn *Connection) handleWrite(fd int) error {
-	fmt.Println("handleWrite: fd:", fd)
-
 	// 1. 如果缓冲区中没有可读数据，则直接写入fd
 
 	// 2. 否则说明写入过，则追加到缓冲区后边
 
 	// redis 是使用链表把缓冲区拉起来
 	// muduo 采用了上边说的策略
-	// mdgo 如何处理呢???
+	// mdgo 同 redis, 输出队列为链表, 通过 writev 一次写出多块
 
-	n, err := syscall.Write(conn.Fd(), conn.OutBuf.PeekAll())
-	if err != nil {
-		if err == syscall.EAGAIN { /// 之后，再次处理
-			fmt.Println("happen EAGAIN")
-			return nil
+	// 边缘触发下读写事件始终注册, 输出队列为空时的可写通知直接忽略
+	if conn.OutBuf.ReadableBytes() == 0 {
+		return nil
+	}
+
+	// 边缘触发下写到 EAGAIN 或写完为止, 否则空间释放前不会再通知
+	for conn.OutBuf.ReadableBytes() > 0 {
+		_, err := conn.OutBuf.WriteFd(fd, conn.eventLoop.iovecs)
+		if err != 0 {
+			if err == syscall.EAGAIN { /// 之后，再次处理
+				conn.eventLoop.logger.Debugf("fd %d: write EAGAIN", fd)
+				return nil
+			}
+			// 处理HUP事件
+			return conn.handleClose()
+		}
+		if !conn.edgeTriggered {
+			break
 		}
-		// 处理HUP事件
-		return conn.handleClose()
 	}
 
-	if n == conn.OutBuf.ReadableBytes() {
+	return conn.writeDone()
+}
+
+// 写出之后检查低水位, 输出缓冲写完时取消写事件并回调 OnWriteComplete
+func (conn *Connection) writeDone() error {
+	conn.checkLowWater()
+
+	if conn.OutBuf.ReadableBytes() == 0 {
 
 		// 已经写完了
 		// 则取消写事件
 		// 激活读事件
-		_ = conn.eventLoop.EnableRead(conn.Fd())
+		_ = conn.setEvents(conn.events &^ event.EventWrite)
 
 		// cb4
 		// 这是缓冲区中，数据写完
 		conn.cb.OnWriteComplete()
-	}
 
-	conn.OutBuf.Retrieve(n)
+		if conn.closing {
+			return conn.handleClose()
+		}
+	}
 
 	return nil
 }
 
 // 3. 处理关闭
-//
 func (conn *Connection) handleClose() error {
 
 	if conn.connected.Get() {
 		conn.connected.Set(false)
 
-		conn.eventLoop.DeleteInLoop(conn.Fd()) //
+		// 完成式 I/O 下即使不关注事件, 也可能有未完成的请求, 删除时取消
+		if conn.completion || conn.events != event.EventNone {
+			conn.eventLoop.DeleteInLoop(conn.Fd()) //
+		} else {
+			delete(conn.eventLoop.socketCtx, conn.Fd())
+		}
+		if conn.idleWheel != nil {
+			conn.idleWheel.remove(conn)
+		}
+
+		// 转发的另一端随之关闭
+		if p := conn.pipe; p != nil {
+			p.close(conn)
+		} else if p := conn.pipeWait; p != nil {
+			p.close(conn)
+		}
 
 		// cb 3
 		conn.cb.OnClose()
+		if conn.closeCb != nil {
+			conn.closeCb(conn)
+		}
+
+		// 本轮事件处理及回调结束后再归还缓冲
+		conn.eventLoop.QueueInLoop(conn.releaseBuffers)
 
 		/// 何时使用优雅关闭
 		if err := syscall.Close(conn.Fd()); err != nil {
-			fmt.Println("close fd err: ", err)
+			conn.eventLoop.logger.Errorf("fd %d: close err: %v", conn.Fd(), err)
 			return err
 		}
 	}
 	return nil
 }
 
-// 4. 处理错误
+// 输出缓冲从低于高水位变为达到高水位时回调
+func (conn *Connection) checkHighWater() {
+	if conn.highWater <= 0 || conn.aboveHigh {
+		return
+	}
+	if queued := conn.OutBuf.ReadableBytes(); queued >= conn.highWater {
+		conn.aboveHigh = true
+		if cb, ok := conn.cb.(HighWaterMarkCallback); ok {
+			cb.OnHighWaterMark(conn, queued)
+		}
+	}
+}
+
+// 达到高水位后, 输出缓冲降至低水位及以下时回调
+func (conn *Connection) checkLowWater() {
+	if !conn.aboveHigh {
+		return
+	}
+	if queued := conn.OutBuf.ReadableBytes(); queued <= conn.lowWater {
+		conn.aboveHigh = false
+		if cb, ok := conn.cb.(LowWaterMarkCallback); ok {
+			cb.OnLowWaterMark(conn, queued)
+		}
+	}
+}
+
+// 暂停读取, 不再关注读事件, 数据留在内核接收缓冲区中, 由 TCP 流控使对端减速
+// 可以在任意协程中调用, 非本循环协程调用时在事件循环中异步执行
+func (conn *Connection) StopRead() {
+	conn.eventLoop.RunInLoop(func() {
+		if !conn.connected.Get() || conn.readPaused {
+			return
+		}
+		conn.readPaused = true
+		if err := conn.setEvents(conn.events); err != nil {
+			conn.eventLoop.logger.Errorf("fd %d: stop read err: %v", conn.Fd(), err)
+		}
+	})
+}
+
+// 恢复读取, 可以在任意协程中调用
+func (conn *Connection) StartRead() {
+	conn.eventLoop.RunInLoop(func() {
+		if !conn.connected.Get() || !conn.readPaused {
+			return
+		}
+		conn.readPaused = false
+		// 完成式 I/O 下先处理暂停期间已读到 InBuf 的数据, 再继续读
+		if conn.completion {
+			if conn.pipeWait == nil && conn.InBuf.ReadableBytes() > 0 {
+				conn.handleMessage(time.Now().Unix())
+			}
+			if err := conn.setEvents(conn.events | event.EventRead); err != nil {
+				conn.eventLoop.logger.Errorf("fd %d: start read err: %v", conn.Fd(), err)
+			}
+			return
+		}
+		// 边缘触发下暂停期间到达的数据不会再通知, 需主动读取
+		if conn.edgeTriggered {
+			if conn.pipe != nil {
+				conn.pipe.resume(conn)
+			} else {
+				_ = conn.handleRead(time.Now().Unix())
+			}
+			return
+		}
+		if conn.pipe != nil {
+			conn.pipe.updateEvents()
+			return
+		}
+		if err := conn.setEvents(conn.events | event.EventRead); err != nil {
+			conn.eventLoop.logger.Errorf("fd %d: start read err: %v", conn.Fd(), err)
+		}
+	})
+}
+
+// 是否已暂停读取, 需在事件循环中调用
+func (conn *Connection) IsReadPaused() bool {
+	return conn.readPaused
+}
+
+// 注册到事件循环, 需在事件循环中调用
+// 轮询器支持完成式 I/O 时使用完成式 I/O, 没有触发方式之分, 忽略边缘触发;
+// 边缘触发时读写事件一次注册, 之后不再修改; 轮询器不支持时使用水平触发
+func (conn *Connection) register() error {
+	if conn.eventLoop.completion != nil {
+		if conn.edgeTriggered {
+			conn.eventLoop.logger.Warnf("fd %d: completion-based poller ignores edge-triggered mode", conn.Fd())
+			conn.edgeTriggered = false
+		}
+		if err := conn.eventLoop.AddSocketCompletion(conn.Fd(), conn); err != nil {
+			return err
+		}
+		conn.completion = true
+		conn.events = event.EventRead
+		return conn.submit()
+	}
+	if conn.edgeTriggered && !conn.eventLoop.EdgeTriggeredSupported() {
+		conn.eventLoop.logger.Warnf("fd %d: poller does not support edge-triggered mode, use level-triggered", conn.Fd())
+		conn.edgeTriggered = false
+	}
+	if conn.edgeTriggered {
+		conn.events = event.EventRead | event.EventWrite
+		return conn.eventLoop.AddSocketEdgeTriggered(conn.Fd(), conn)
+	}
+	return conn.eventLoop.AddSocketAndEnableRead(conn.Fd(), conn)
+}
 
-func (conn *Connection) handleError(fd int) {
+// 更新关注的事件, 与当前相同时不做系统调用, 需在事件循环中调用
+// 暂停读取时忽略读事件; 边缘触发时不修改; 完成式 I/O 下按关注的事件提交请求
+func (conn *Connection) setEvents(ev event.Event) error {
+	if conn.edgeTriggered {
+		return nil
+	}
+	if conn.readPaused {
+		ev &^= event.EventRead
+	}
+	if conn.completion {
+		conn.events = ev
+		return conn.submit()
+	}
+	if ev == conn.events {
+		return nil
+	}
+	old := conn.events
+	conn.events = ev
+	return conn.eventLoop.UpdateEvents(conn.Fd(), old, ev)
+}
+
+// 归还输入输出缓冲, 之后 InBuf/OutBuf 为 nil
+// 未发送的 SendOwned 数据以 ErrConnectionClosed 通知; 写请求未完成时内核可能仍在读取, 输出缓冲不归还
+func (conn *Connection) releaseBuffers() {
+	buffer.Put(conn.InBuf)
+	if conn.sending {
+		conn.OutBuf.Drop(mdgoErr.ErrConnectionClosed)
+	} else {
+		conn.OutBuf.Release(mdgoErr.ErrConnectionClosed)
+	}
+	conn.InBuf, conn.OutBuf = nil, nil
+}
+
+// 发送完输出缓冲中的数据后关闭连接, 需在事件循环中调用
+func (conn *Connection) closeAfterFlush() {
+	if conn.OutBuf.ReadableBytes() == 0 {
+		_ = conn.handleClose()
+		return
+	}
+	conn.closing = true
+}
+
+// 4. 处理错误
+// 读取并记录套接字错误(SO_ERROR), 没有错误时返回 nil
+func (conn *Connection) handleError(fd int) error {
 	nerr, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_ERROR)
 	if err != nil {
-		fmt.Println("TcpConnection::handleError => fd: ", fd, "; err: ", os.NewSyscallError("getsockopt", err))
-		return
+		err = os.NewSyscallError("getsockopt", err)
+		conn.eventLoop.logger.Errorf("TcpConnection::handleError => fd: %d; err: %v", fd, err)
+		return err
+	}
+	if nerr == 0 {
+		return nil
 	}
 
 	osErr := syscall.Errno(nerr)
-	fmt.Println("TcpConnection::handleError => fd: ", fd, "; err: ", osErr.Error())
-
-	// 这里真的有错误发生了，应该处理错误了
-	// 直接退出程序???
-	// 还是关闭连接???
-	//
-	//
-	return
+	conn.eventLoop.logger.Errorf("TcpConnection::handleError => fd: %d; err: %v", fd, osErr)
+	return osErr
+}
+
+// ********* socket options *********** //
+func (conn *Connection) SetNoDelay(noDelay bool) error {
+	if !conn.connected.Get() {
+		return mdgoErr.ErrConnectionClosed
+	}
+	return setNoDelay(conn.Fd(), noDelay)
+}
+
+func (conn *Connection) SetKeepAlive(d time.Duration) error {
+	if !conn.connected.Get() {
+		return mdgoErr.ErrConnectionClosed
+	}
+	return setKeepAlive(conn.Fd(), d)
+}
+
+func (conn *Connection) SetReadBuffer(bytes int) error {
+	if !conn.connected.Get() {
+		return mdgoErr.ErrConnectionClosed
+	}
+	return setRecvBuffer(conn.Fd(), bytes)
+}
+
+func (conn *Connection) SetWriteBuffer(bytes int) error {
+	if !conn.connected.Get() {
+		return mdgoErr.ErrConnectionClosed
+	}
+	return setSendBuffer(conn.Fd(), bytes)
+}
+
+func (conn *Connection) SetLinger(sec int) error {
+	if !conn.connected.Get() {
+		return mdgoErr.ErrConnectionClosed
+	}
+	return setLinger(conn.Fd(), sec)
+}
+
+func (conn *Connection) SetUserTimeout(d time.Duration) error {
+	if !conn.connected.Get() {
+		return mdgoErr.ErrConnectionClosed
+	}
+	return setUserTimeout(conn.Fd(), d)
+}
+
+func (conn *Connection) SetQuickAck(quickAck bool) error {
+	if !conn.connected.Get() {
+		return mdgoErr.ErrConnectionClosed
+	}
+	return setQuickAck(conn.Fd(), quickAck)
 }
 
 // 平滑关闭
@@ -0,0 +1,496 @@
+package net
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aizsfgk/mdgo/net/buffer"
+	mdgoErr "github.com/aizsfgk/mdgo/net/errors"
+)
+
+// 测试用回调句柄
+type testHandler struct {
+	onConnection    func(conn *Connection)
+	onMessage       func(conn *Connection, nowUnix int64)
+	onClose         func()
+	onWriteComplete func()
+	onHighWaterMark func(conn *Connection, queued int)
+	onLowWaterMark  func(conn *Connection, queued int)
+}
+
+func (h *testHandler) OnEventLoopInit(conn *Connection) {}
+
+func (h *testHandler) OnConnection(conn *Connection) {
+	if h.onConnection != nil {
+		h.onConnection(conn)
+	}
+}
+
+func (h *testHandler) OnMessage(conn *Connection, nowUnix int64) {
+	if h.onMessage != nil {
+		h.onMessage(conn, nowUnix)
+		return
+	}
+	conn.InBuf.RetrieveAll()
+}
+
+func (h *testHandler) OnClose() {
+	if h.onClose != nil {
+		h.onClose()
+	}
+}
+
+func (h *testHandler) OnWriteComplete() {
+	if h.onWriteComplete != nil {
+		h.onWriteComplete()
+	}
+}
+
+func (h *testHandler) OnHighWaterMark(conn *Connection, queued int) {
+	if h.onHighWaterMark != nil {
+		h.onHighWaterMark(conn, queued)
+	}
+}
+
+func (h *testHandler) OnLowWaterMark(conn *Connection, queued int) {
+	if h.onLowWaterMark != nil {
+		h.onLowWaterMark(conn, queued)
+	}
+}
+
+type testServer struct {
+	*Server
+	done chan struct{} // Start 返回
+}
+
+// 启动监听随机端口的服务器, 测试结束时停止
+func startTestServer(t testing.TB, handler Handler, optionCbs ...OptionCallback) *testServer {
+	optionCbs = append([]OptionCallback{Addr("127.0.0.1:0")}, optionCbs...)
+	serv, err := NewServer(handler, optionCbs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := &testServer{Server: serv, done: make(chan struct{})}
+	go func() {
+		_ = serv.Start()
+		close(ts.done)
+	}()
+	t.Cleanup(func() {
+		serv.Stop()
+		select {
+		case <-ts.done:
+		case <-time.After(5 * time.Second):
+			t.Error("Start does not return after Stop")
+		}
+	})
+	return ts
+}
+
+func TestConnectionSendFromManyGoroutines(t *testing.T) {
+	const (
+		senders = 16
+		msgNum  = 5000
+	)
+
+	connCh := make(chan *Connection, 1)
+	serv := startTestServer(t, &testHandler{
+		onConnection: func(conn *Connection) {
+			connCh <- conn
+		},
+	})
+
+	cli, err := net.Dial("tcp", serv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	var conn *Connection
+	select {
+	case conn = <-connCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no connection")
+	}
+
+	// 每条消息: "sender:seq:padding\n"
+	padding := strings.Repeat("x", 100)
+	var wg sync.WaitGroup
+	for s := 0; s < senders; s++ {
+		wg.Add(1)
+		go func(s int) {
+			defer wg.Done()
+			for i := 0; i < msgNum; i++ {
+				msg := fmt.Sprintf("%d:%d:%s\n", s, i, padding)
+				if err := conn.SendString(msg); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(s)
+	}
+
+	// 发送完毕后才开始读, 使内核发送缓冲区写满, 剩余数据进入 OutBuf
+	wg.Wait()
+
+	_ = cli.SetReadDeadline(time.Now().Add(30 * time.Second))
+	next := make([]int, senders)
+	rd := bufio.NewReader(cli)
+	for got := 0; got < senders*msgNum; got++ {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				t.Fatalf("unexpected EOF after %d messages", got)
+			}
+			t.Fatal(err)
+		}
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 || fields[2] != padding+"\n" {
+			t.Fatalf("corrupted message: %q", line)
+		}
+		s, _ := strconv.Atoi(fields[0])
+		i, _ := strconv.Atoi(fields[1])
+		if s < 0 || s >= senders {
+			t.Fatalf("unknown sender: %q", line)
+		}
+		if i != next[s] {
+			t.Fatalf("sender %d: got seq %d, want %d", s, i, next[s])
+		}
+		next[s]++
+	}
+}
+
+func TestConnectionBufferShrinkAndRelease(t *testing.T) {
+	const total = 256 * 1024
+
+	connCh := make(chan *Connection, 1)
+	closed := make(chan struct{})
+	var received int64
+	serv := startTestServer(t, &testHandler{
+		onConnection: func(conn *Connection) { connCh <- conn },
+		onMessage: func(conn *Connection, nowUnix int64) {
+			received += int64(conn.InBuf.ReadableBytes())
+			conn.InBuf.RetrieveAll()
+		},
+		onClose: func() { close(closed) },
+	})
+
+	cli, err := net.Dial("tcp", serv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	conn := <-connCh
+
+	if _, err = cli.Write(make([]byte, total)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 在事件循环中检查连接状态
+	inLoop := func(f func()) {
+		done := make(chan struct{})
+		conn.Loop().RunInLoop(func() {
+			// 再排队一次, 保证在 handleClose 排入的任务之后执行
+			conn.Loop().QueueInLoop(func() {
+				f()
+				close(done)
+			})
+		})
+		<-done
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var n int64
+		inLoop(func() { n = received })
+		if n == total {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("received %d bytes, want %d", n, total)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	inLoop(func() {
+		if c := conn.InBuf.Cap(); c > buffer.DefaultSize {
+			t.Errorf("InBuf cap %d after drained, want <= %d", c, buffer.DefaultSize)
+		}
+	})
+
+	_ = cli.Close()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection is not closed")
+	}
+	inLoop(func() {
+		if conn.InBuf != nil || conn.OutBuf != nil {
+			t.Error("buffers are not released after close")
+		}
+	})
+}
+
+func TestConnectionSendOwned(t *testing.T) {
+	const (
+		chunks = 8
+		size   = 1 << 20
+	)
+
+	type result struct {
+		idx int
+		err error
+	}
+	doneCh := make(chan result, chunks)
+	var want []byte
+	for i := 0; i < chunks; i++ {
+		want = append(want, bytes.Repeat([]byte{byte('a' + i)}, size)...)
+	}
+	serv := startTestServer(t, &testHandler{
+		onConnection: func(conn *Connection) {
+			for i := 0; i < chunks; i++ {
+				i := i
+				b := want[i*size : (i+1)*size]
+				if err := conn.SendOwned(b, func(err error) { doneCh <- result{i, err} }); err != nil {
+					t.Error(err)
+				}
+			}
+		},
+	})
+
+	cli, err := net.Dial("tcp", serv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	// 客户端读取之前, 内核缓冲区写满, 后面的块尚未完成
+	time.Sleep(50 * time.Millisecond)
+	if n := len(doneCh); n == chunks {
+		t.Fatal("all chunks done before client reads")
+	}
+
+	_ = cli.SetReadDeadline(time.Now().Add(10 * time.Second))
+	got := make([]byte, chunks*size)
+	if _, err = io.ReadFull(cli, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("data mismatch")
+	}
+	for i := 0; i < chunks; i++ {
+		select {
+		case r := <-doneCh:
+			if r.idx != i || r.err != nil {
+				t.Fatalf("done #%d: chunk %d, err %v", i, r.idx, r.err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("chunk %d not done", i)
+		}
+	}
+}
+
+func TestConnectionSendOwnedClosed(t *testing.T) {
+	const chunks = 8
+
+	errCh := make(chan error, chunks)
+	serv := startTestServer(t, &testHandler{
+		onConnection: func(conn *Connection) {
+			for i := 0; i < chunks; i++ {
+				_ = conn.SendOwned(make([]byte, 1<<20), func(err error) { errCh <- err })
+			}
+		},
+	})
+
+	cli, err := net.Dial("tcp", serv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	// 不读取直接关闭, 服务端写出错后关闭连接, 未发完的块以 ErrConnectionClosed 通知
+	_ = cli.(*net.TCPConn).SetLinger(0)
+	_ = cli.Close()
+
+	var closedNum int
+	for i := 0; i < chunks; i++ {
+		select {
+		case err := <-errCh:
+			if err == mdgoErr.ErrConnectionClosed {
+				closedNum++
+			} else if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d of %d done callbacks called", i, chunks)
+		}
+	}
+	if closedNum == 0 {
+		t.Fatal("no chunk reported ErrConnectionClosed")
+	}
+}
+
+func TestConnectionSendFile(t *testing.T) {
+	content := bytes.Repeat([]byte("mdgo sendfile\n"), 300*1024)
+	f, err := ioutil.TempFile(t.TempDir(), "sendfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err = f.Write(content); err != nil {
+		t.Fatal(err)
+	}
+
+	const offset = 5
+	length := int64(len(content) - 10)
+	completed := make(chan struct{}, 1)
+	serv := startTestServer(t, &testHandler{
+		onConnection: func(conn *Connection) {
+			_ = conn.SendString("header\n")
+			if err := conn.SendFile(f, offset, length); err != nil {
+				t.Error(err)
+			}
+			_ = conn.SendString("trailer\n")
+		},
+		onWriteComplete: func() {
+			select {
+			case completed <- struct{}{}:
+			default:
+			}
+		},
+	})
+
+	cli, err := net.Dial("tcp", serv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	want := "header\n" + string(content[offset:offset+length]) + "trailer\n"
+	got := make([]byte, len(want))
+	_ = cli.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if _, err = io.ReadFull(cli, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Fatal("data mismatch")
+	}
+	select {
+	case <-completed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnWriteComplete not called after file is sent")
+	}
+}
+
+func TestConnectionWaterMark(t *testing.T) {
+	const (
+		high  = 1 << 20
+		low   = 64 * 1024
+		total = 8 << 20
+	)
+
+	highCh := make(chan int, 2)
+	lowCh := make(chan int, 2)
+	serv := startTestServer(t, &testHandler{
+		onConnection: func(conn *Connection) {
+			// 分多次发送, 只在首次达到高水位时回调
+			chunk := make([]byte, 64*1024)
+			for i := 0; i < total/len(chunk); i++ {
+				_ = conn.Send(chunk)
+			}
+		},
+		onHighWaterMark: func(conn *Connection, queued int) { highCh <- queued },
+		onLowWaterMark:  func(conn *Connection, queued int) { lowCh <- queued },
+	}, HighWaterMark(high), LowWaterMark(low))
+
+	cli, err := net.Dial("tcp", serv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	select {
+	case queued := <-highCh:
+		if queued < high {
+			t.Fatalf("OnHighWaterMark queued %d, want >= %d", queued, high)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnHighWaterMark not called")
+	}
+	select {
+	case queued := <-lowCh:
+		t.Fatalf("OnLowWaterMark called before client reads, queued %d", queued)
+	default:
+	}
+
+	_ = cli.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if _, err = io.CopyN(ioutil.Discard, cli, total); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case queued := <-lowCh:
+		if queued > low {
+			t.Fatalf("OnLowWaterMark queued %d, want <= %d", queued, low)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnLowWaterMark not called")
+	}
+	if len(highCh) != 0 {
+		t.Fatal("OnHighWaterMark called more than once")
+	}
+}
+
+func TestConnectionStopStartRead(t *testing.T) {
+	for _, mode := range ioModes {
+		t.Run(mode.name, func(t *testing.T) {
+			testConnectionStopStartRead(t, mode)
+		})
+	}
+}
+
+func testConnectionStopStartRead(t *testing.T, mode ioMode) {
+	connCh := make(chan *Connection, 1)
+	msgCh := make(chan string, 16)
+	serv := startTestServer(t, &testHandler{
+		onConnection: func(conn *Connection) {
+			conn.StopRead()
+			connCh <- conn
+		},
+		onMessage: func(conn *Connection, nowUnix int64) {
+			msgCh <- conn.InBuf.RetrieveAllAsString()
+		},
+	}, mode.options()...)
+
+	cli, err := net.Dial("tcp", serv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	conn := <-connCh
+
+	if _, err = cli.Write([]byte("paused")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-msgCh:
+		t.Fatalf("OnMessage %q called while reading is paused", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	conn.StartRead()
+	select {
+	case msg := <-msgCh:
+		if msg != "paused" {
+			t.Fatalf("got %q", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnMessage not called after StartRead")
+	}
+}
@@ -0,0 +1,171 @@
+package net
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	mdgoErr "github.com/aizsfgk/mdgo/net/errors"
+	"github.com/aizsfgk/mdgo/net/event"
+)
+
+type HandlerConnErrFunc func(err error)
+
+// 连接器: 非阻塞 connect
+// 1. connect 返回 EINPROGRESS, 关注写事件
+// 2. 可写时通过 SO_ERROR 判断是否连接成功
+// 3. 成功则移出事件循环, 交给 handleNewConn 建立 Connection
+type Connector struct {
+	sa            syscall.Sockaddr   // 对端地址
+	domain        int                // AF_INET/AF_INET6
+	timeout       time.Duration      // 连接超时, 0 表示不限制
+	connFd        int                // connecting fd
+	connecting    bool               // 是否正在连接
+	timerId       TimerId            // 超时定时器
+	handleNewConn HandlerConnFunc    // 连接成功
+	handleErr     HandlerConnErrFunc // 连接失败
+	loop          *EventLoop         // pointer eventloop
+}
+
+// 新建连接器, 地址在此解析, 避免在事件循环中阻塞
+func NewConnector(network, addr string, timeout time.Duration, loop *EventLoop, handleConn HandlerConnFunc, handleErr HandlerConnErrFunc) (*Connector, error) {
+	tcpAddr, err := net.ResolveTCPAddr(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Connector{
+		timeout:       timeout,
+		connFd:        -1,
+		handleNewConn: handleConn,
+		handleErr:     handleErr,
+		loop:          loop,
+	}
+	if ip4 := tcpAddr.IP.To4(); ip4 != nil || tcpAddr.IP == nil {
+		sa := &syscall.SockaddrInet4{Port: tcpAddr.Port}
+		copy(sa.Addr[:], ip4)
+		c.sa, c.domain = sa, syscall.AF_INET
+	} else {
+		sa := &syscall.SockaddrInet6{Port: tcpAddr.Port}
+		copy(sa.Addr[:], tcpAddr.IP.To16())
+		c.sa, c.domain = sa, syscall.AF_INET6
+	}
+	return c, nil
+}
+
+// 发起连接, 可以在任意协程中调用
+func (c *Connector) Start() {
+	c.loop.RunInLoop(c.connect)
+}
+
+// 停止正在进行的连接, 可以在任意协程中调用
+func (c *Connector) Stop() {
+	c.loop.RunInLoop(func() {
+		_ = c.Close()
+	})
+}
+
+func (c *Connector) connect() {
+	if c.connecting {
+		return
+	}
+
+	fd, err := syscall.Socket(c.domain, syscall.SOCK_STREAM|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, syscall.IPPROTO_TCP)
+	if err != nil {
+		c.handleErr(os.NewSyscallError("socket", err))
+		return
+	}
+
+	err = syscall.Connect(fd, c.sa)
+	switch err {
+	case nil, syscall.EINPROGRESS, syscall.EINTR, syscall.EISCONN:
+		// 等待可写
+	default:
+		_ = syscall.Close(fd)
+		c.handleErr(os.NewSyscallError("connect", err))
+		return
+	}
+
+	if err = c.loop.AddSocketAndEnableWrite(fd, c); err != nil {
+		_ = syscall.Close(fd)
+		c.handleErr(err)
+		return
+	}
+	c.connFd = fd
+	c.connecting = true
+
+	if c.timeout > 0 {
+		c.timerId = c.loop.RunAfter(c.timeout, c.handleTimeout)
+	}
+}
+
+// 移出事件循环, 返回连接中的 fd
+func (c *Connector) removeAndResetFd() int {
+	fd := c.connFd
+	c.loop.DeleteInLoop(fd)
+	c.loop.Cancel(c.timerId)
+	c.connFd = -1
+	c.connecting = false
+	return fd
+}
+
+// 可写或出错, 说明连接已有结果
+func (c *Connector) HandleEvent(eve event.Event, nowUnix int64) error {
+	if !c.connecting {
+		return nil
+	}
+	fd := c.removeAndResetFd()
+
+	nerr, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_ERROR)
+	if err == nil && nerr != 0 {
+		err = syscall.Errno(nerr)
+	}
+	if err != nil {
+		_ = syscall.Close(fd)
+		c.handleErr(os.NewSyscallError("connect", err))
+		return nil
+	}
+
+	sa, err := syscall.Getpeername(fd)
+	if err != nil {
+		_ = syscall.Close(fd)
+		c.handleErr(os.NewSyscallError("getpeername", err))
+		return nil
+	}
+	if isSelfConnect(fd, sa) {
+		_ = syscall.Close(fd)
+		c.handleErr(mdgoErr.ErrSelfConnect)
+		return nil
+	}
+
+	c.loop.logger.Debugf("connector: connected fd: %d", fd)
+	return c.handleNewConn(fd, sa)
+}
+
+func (c *Connector) handleTimeout() {
+	if !c.connecting {
+		return
+	}
+	fd := c.removeAndResetFd()
+	_ = syscall.Close(fd)
+	c.handleErr(mdgoErr.ErrConnectTimeout)
+}
+
+// 放弃正在进行的连接, 需在事件循环中调用
+func (c *Connector) Close() error {
+	if !c.connecting {
+		return nil
+	}
+	fd := c.removeAndResetFd()
+	return syscall.Close(fd)
+}
+
+// 连接本机未监听的端口时, 可能连接到自己(源端口与目的端口相同)
+func isSelfConnect(fd int, peer syscall.Sockaddr) bool {
+	local, err := syscall.Getsockname(fd)
+	if err != nil {
+		return false
+	}
+	return sockAddrToString(local) == sockAddrToString(peer)
+}
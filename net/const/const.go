@@ -4,4 +4,5 @@ const (
 	SocketContextSize   = 16
 	PollWaitMillisecond = 1000
 	PollWaitEventsSize  = 16
+	ExtraBufSize        = 65536 // readv 的临时缓冲, 每个事件循环一个
 )
@@ -9,4 +9,19 @@ var (
 	ListenerIsNotTcp    = errors.New("listener is not tcp")
 	EventIsNil          = errors.New("event is nil")
 	ErrConnectionClosed = errors.New("connection closed")
+	ErrConnectTimeout   = errors.New("connect timeout")
+	ErrSelfConnect      = errors.New("self connect")
+	ErrNoFrameCallback  = errors.New("codec is set but handler does not implement OnFrame")
+	ErrCodecIsNil       = errors.New("codec is nil")
+	ErrUnsupportedMsg   = errors.New("unsupported message type")
+	ErrFrameTooLarge    = errors.New("frame too large")
+	ErrInvalidFrameLen  = errors.New("invalid frame length")
+	ErrInvalidLenField  = errors.New("invalid length field config")
+	ErrInvalidDelimiter = errors.New("invalid delimiter")
+	ErrConnectionPiped  = errors.New("connection is piped")
+	ErrNotSameLoop      = errors.New("connections are not in the same event loop")
+	ErrUnknownPoller    = errors.New("unknown poller")
+
+	ErrEdgeTriggeredUnsupported = errors.New("poller does not support edge-triggered mode")
+	ErrCompletionUnsupported    = errors.New("poller does not support completion-based I/O")
 )
@@ -11,10 +11,24 @@ const (
 	EventError Event = 0x04
 )
 
+// 完成式轮询器(io_uring)中已完成的操作, 就绪通知为 OpNone
+type Op uint8
+
+const (
+	OpNone     Op = iota
+	OpRecv        // 读完成, Data 为读到的数据, Res 为 0 表示对端关闭
+	OpSend        // 写完成, Res 为写出的字节数
+	OpAccept      // accept 完成, Res 为新连接的 fd
+	OpWritable    // 可写, 用于 sendfile 等不能提交给轮询器的写
+)
+
 type EventHolder struct {
-	Fd     int   // fd
-	Event  Event // 关注的事件
-	Revent Event // 就绪的事件
+	Fd     int    // fd
+	Event  Event  // 关注的事件
+	Revent Event  // 就绪的事件
+	Op     Op     // 完成的操作
+	Res    int    // 操作的结果, 出错时为 -errno
+	Data   []byte // OpRecv 读到的数据, 属于轮询器, 在下一次 Poll 之前有效
 }
 
 func (e *EventHolder) Event2String() (out string) {
@@ -0,0 +1,58 @@
+package net
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/aizsfgk/mdgo/net/event"
+)
+
+const (
+	efdNonblock = syscall.O_NONBLOCK
+	efdCloexec  = syscall.O_CLOEXEC
+)
+
+// eventfd 唤醒器
+// 其他协程向 eventfd 写入, 使阻塞在 epoll_wait 的事件循环立即返回
+type eventFd struct {
+	fd int
+}
+
+func newEventFd() (*eventFd, error) {
+	r0, _, e := syscall.Syscall(syscall.SYS_EVENTFD2, 0, efdNonblock|efdCloexec, 0)
+	if e != 0 {
+		return nil, e
+	}
+	return &eventFd{fd: int(r0)}, nil
+}
+
+func (e *eventFd) Fd() int {
+	return e.fd
+}
+
+// 唤醒: 计数器加1
+func (e *eventFd) wakeup() error {
+	var one uint64 = 1
+	b := (*(*[8]byte)(unsafe.Pointer(&one)))[:]
+	_, err := syscall.Write(e.fd, b)
+	if err == syscall.EAGAIN { // 计数器已满, 事件循环必然会被唤醒
+		return nil
+	}
+	return err
+}
+
+// 读取计数器, 否则水平触发下会一直通知
+func (e *eventFd) HandleEvent(eve event.Event, nowUnix int64) error {
+	if eve&event.EventRead != 0 {
+		var b [8]byte
+		_, err := syscall.Read(e.fd, b[:])
+		if err != nil && err != syscall.EAGAIN {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *eventFd) Close() error {
+	return syscall.Close(e.fd)
+}
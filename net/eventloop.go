@@ -1,10 +1,15 @@
 package net
 
 import (
-	"fmt"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/aizsfgk/mdgo/base/atomic"
+	"github.com/aizsfgk/mdgo/base/goid"
+	"github.com/aizsfgk/mdgo/net/buffer"
 	_const "github.com/aizsfgk/mdgo/net/const"
+	mdgoErr "github.com/aizsfgk/mdgo/net/errors"
 	"github.com/aizsfgk/mdgo/net/event"
 	"github.com/aizsfgk/mdgo/net/poller"
 )
@@ -19,27 +24,85 @@ type SocketContext interface {
 
 // 事件循环
 type EventLoop struct {
-	Poll          *poller.Poller        // net poller
+	Poll          poller.Poller         // net poller
 	LoopId        string                // identify
 	socketCtx     map[int]SocketContext // fd <-> SocketContext
 	quit          atomic.Bool           // is quit
 	eventHandling atomic.Bool           // is handle event
+	goId          atomic.Int64          // goroutine id which runs Loop
+	wakeupFd      *eventFd              // wakeup epoll_wait
+	timerQueue    *timerQueue           // timerfd timers
+	idleWheel     *timingWheel          // idle connections, set by server
+	mu            sync.Mutex            // guard pendingFuncs/stopped
+	pendingFuncs  []func()              // functors queued by other goroutines
+	stopped       bool                  // resources are released
+	callingFuncs  atomic.Bool           // is calling pending functors
+	spareFuncs    []func()              // swapped with pendingFuncs, reused
+	activeEvents  []event.EventHolder   // filled by Poll, reused
+	extraBuf      []byte                // shared by reads of the loop's connections
+	iovecs        []syscall.Iovec       // shared by writev of the loop's connections
+	logger        Logger                // logger of the loop and its sockets
+
+	completion poller.CompletionPoller // non-nil if Poll submits reads/writes/accepts (io_uring)
+	deleted    []int                   // fds deleted while handling the current events
 }
 
-// New/Loop/Stop
+// New/Loop/Stop/Quit
 // Enable Read/Write/ReadWrite
 // DeleteInLoop
+// RunInLoop/QueueInLoop
+// RunAt/RunAfter/RunEvery/Cancel
 
 // new EventLoop
-func NewEventLoop() (el *EventLoop, err error) {
-	poll, err := poller.Create()
+// 选项中仅 WithLogger 及 WithPoller 生效
+func NewEventLoop(optionCbs ...OptionCallback) (el *EventLoop, err error) {
+	return newEventLoop(newOption(optionCbs...))
+}
+
+func newEventLoop(opt *Option) (el *EventLoop, err error) {
+	poll, err := poller.New(opt.Poller, opt.Logger)
+	if err != nil {
+		return nil, err
+	}
+	return newEventLoopWithPoller(opt, poll)
+}
+
+// 使用指定的轮询器, 例如测试中的 pollertest.Poller; 出错时关闭 poll
+func newEventLoopWithPoller(opt *Option, poll poller.Poller) (el *EventLoop, err error) {
+	wakeupFd, err := newEventFd()
 	if err != nil {
+		_ = poll.Close()
 		return nil, err
 	}
-	return &EventLoop{
+	el = &EventLoop{
 		Poll:      poll,
 		socketCtx: make(map[int]SocketContext, _const.SocketContextSize),
-	}, nil
+		wakeupFd:  wakeupFd,
+		logger:    opt.Logger,
+
+		activeEvents: make([]event.EventHolder, poller.WaitEventsBegin),
+		extraBuf:     make([]byte, _const.ExtraBufSize),
+		iovecs:       make([]syscall.Iovec, buffer.IovMax),
+	}
+	el.completion, _ = poll.(poller.CompletionPoller)
+	if err = el.AddSocketAndEnableRead(wakeupFd.Fd(), wakeupFd); err != nil {
+		_ = wakeupFd.Close()
+		_ = poll.Close()
+		return nil, err
+	}
+
+	el.timerQueue, err = newTimerQueue(opt.Logger)
+	if err != nil {
+		_ = el.Stop()
+		return nil, err
+	}
+	// 注册失败时 timerfd 不在 socketCtx 中, Stop 不会关闭它
+	if err = el.AddSocketAndEnableRead(el.timerQueue.Fd(), el.timerQueue); err != nil {
+		_ = el.timerQueue.Close()
+		_ = el.Stop()
+		return nil, err
+	}
+	return el, nil
 }
 
 // first add and enable read
@@ -48,63 +111,139 @@ func (el *EventLoop) AddSocketAndEnableRead(fd int, sckCtx SocketContext) error
 
 	el.socketCtx[fd] = sckCtx
 	if err = el.Poll.Add(fd, event.EventRead); err != nil {
-		_ = el.Poll.Del(fd)
+		delete(el.socketCtx, fd)
+		return err
+	}
+	return nil
+}
+
+// first add and enable write, e.g. connecting socket
+func (el *EventLoop) AddSocketAndEnableWrite(fd int, sckCtx SocketContext) error {
+	var err error
+
+	el.socketCtx[fd] = sckCtx
+	if err = el.Poll.Add(fd, event.EventWrite); err != nil {
+		delete(el.socketCtx, fd)
+		return err
+	}
+	return nil
+}
+
+// 轮询器是否支持边缘触发
+func (el *EventLoop) EdgeTriggeredSupported() bool {
+	_, ok := el.Poll.(poller.EdgeTriggeredPoller)
+	return ok
+}
+
+// 以边缘触发方式注册, 同时关注读写事件
+func (el *EventLoop) AddSocketEdgeTriggered(fd int, sckCtx SocketContext) error {
+	etPoll, ok := el.Poll.(poller.EdgeTriggeredPoller)
+	if !ok {
+		return mdgoErr.ErrEdgeTriggeredUnsupported
+	}
+	el.socketCtx[fd] = sckCtx
+	if err := etPoll.AddEdgeTriggered(fd); err != nil {
+		delete(el.socketCtx, fd)
+		return err
+	}
+	return nil
+}
+
+// 以完成式 I/O 注册, 之后通过 el.completion 提交读写请求, 完成事件交给 sckCtx 的 handleCompletion
+func (el *EventLoop) AddSocketCompletion(fd int, sckCtx completionContext) error {
+	if el.completion == nil {
+		return mdgoErr.ErrCompletionUnsupported
+	}
+	el.socketCtx[fd] = sckCtx
+	if err := el.completion.AddCompletion(fd); err != nil {
+		delete(el.socketCtx, fd)
 		return err
 	}
 	return nil
 }
 
 // stop eventLoop
+// 关闭所有套接字并释放 poller, 需要在 Loop 返回之后(或从未启动时)调用
+// 调用者接管事件循环, 已投递的任务会先执行完; 重复调用无副作用
 func (el *EventLoop) Stop() error {
+	el.mu.Lock()
+	if el.stopped {
+		el.mu.Unlock()
+		return nil
+	}
+	el.stopped = true
+	el.mu.Unlock()
+
+	el.quit.Set(true)
+	el.goId.Swap(goid.Get())
+	el.doPendingFuncs()
+
 	for fd, sc := range el.socketCtx {
 		if err := sc.Close(); err != nil {
-			fmt.Println("sc close err")
+			el.logger.Errorf("loop %s: close fd %d err: %v", el.LoopId, fd, err)
 		}
 		delete(el.socketCtx, fd)
 	}
 	return el.Poll.Close()
 }
 
-// debugPrintf
-func (el *EventLoop) debugPrintf(evhs *[]event.EventHolder) {
-	fmt.Println("==========================")
-	fmt.Println("return Event: ")
-	for _, evh := range *evhs {
-		if evh.Fd > 0 {
-			fmt.Printf("fd: %d => events: %s\n", evh.Fd, evh.Event2String())
-		}
-	}
-	fmt.Println("==========================")
-}
-
 // 开启事件循环
 func (el *EventLoop) Loop() {
-	fmt.Println("<<< eventLoop Loop begin; LoopId: ", el.LoopId, ">>>")
+	el.logger.Debugf("loop %s: begin", el.LoopId)
+	el.goId.Swap(goid.Get())
 
 	for !el.quit.Get() {
-		activeEvents := make([]event.EventHolder, poller.WaitEventsBegin)
-		nowUnix, n := el.Poll.Poll(_const.PollWaitMillisecond, &activeEvents)
+		el.loopOnce(_const.PollWaitMillisecond)
+	}
 
-		fmt.Println("return eventLoop; LoopId: ", el.LoopId, "; unix timestamp: ", nowUnix)
+	el.logger.Debugf("loop %s: end", el.LoopId)
+	return
+}
 
-		if n > 0 {
-			el.debugPrintf(&activeEvents)
+// 一轮循环: 等待就绪事件并处理, 然后执行排队的任务
+// 就绪事件及读缓冲均复用, 稳定状态下不分配内存
+func (el *EventLoop) loopOnce(msec int) {
+	nowUnix, n := el.Poll.Poll(msec, &el.activeEvents)
 
-			el.eventHandling.Set(true)
-			for _, curEvent := range activeEvents {
-				if sc, ok := el.socketCtx[curEvent.Fd]; ok {
-					err := sc.HandleEvent(curEvent.Revent, nowUnix)
-					if err != nil {
-						fmt.Println("sc.HandleEvent err: ", err.Error())
-					}
+	if n > 0 {
+		el.eventHandling.Set(true)
+		for i := 0; i < n; i++ {
+			ev := &el.activeEvents[i]
+			if ev.Op != event.OpNone {
+				el.handleCompletion(ev, nowUnix)
+				continue
+			}
+			if sc, ok := el.socketCtx[ev.Fd]; ok {
+				if err := sc.HandleEvent(ev.Revent, nowUnix); err != nil {
+					el.logger.Errorf("loop %s: fd %d HandleEvent err: %v", el.LoopId, ev.Fd, err)
 				}
 			}
-			el.eventHandling.Set(false)
 		}
+		el.eventHandling.Set(false)
+		el.deleted = el.deleted[:0]
 	}
 
-	fmt.Println("<<< eventLoop loop end >>>")
-	return
+	el.doPendingFuncs()
+}
+
+// 处理完成事件
+// 本轮中已删除的 fd 可能已被新连接复用, 新连接的请求在下一次 Poll 时才提交, 本轮剩余的完成事件都属于旧连接
+func (el *EventLoop) handleCompletion(ev *event.EventHolder, nowUnix int64) {
+	for _, fd := range el.deleted {
+		if fd == ev.Fd {
+			if ev.Op == event.OpAccept && ev.Res >= 0 {
+				_ = syscall.Close(ev.Res)
+			}
+			return
+		}
+	}
+	cc, ok := el.socketCtx[ev.Fd].(completionContext)
+	if !ok {
+		return
+	}
+	if err := cc.handleCompletion(ev, nowUnix); err != nil {
+		el.logger.Errorf("loop %s: fd %d handleCompletion err: %v", el.LoopId, ev.Fd, err)
+	}
 }
 
 func (el *EventLoop) EnableRead(fd int) error {
@@ -119,12 +258,155 @@ func (el *EventLoop) EnableReadWrite(fd int) error {
 	return el.Poll.EnableReadWrite(fd)
 }
 
+// 将 fd 关注的事件由 old 改为 ev, 需在事件循环中调用
+// EPOLLHUP/EPOLLERR 总会通知, 不关注任何事件时从 poller 中移除, 之后再关注时重新加入
+func (el *EventLoop) UpdateEvents(fd int, old, ev event.Event) error {
+	if ev == event.EventNone {
+		return el.Poll.Del(fd)
+	}
+	if old == event.EventNone {
+		if err := el.Poll.Add(fd, event.EventRead); err != nil {
+			return err
+		}
+		if ev == event.EventRead {
+			return nil
+		}
+	}
+	switch ev {
+	case event.EventRead:
+		return el.EnableRead(fd)
+	case event.EventWrite:
+		return el.EnableWrite(fd)
+	default:
+		return el.EnableReadWrite(fd)
+	}
+}
+
+// 本循环中的所有连接, 需在事件循环中调用
+func (el *EventLoop) connections() []*Connection {
+	var conns []*Connection
+	for _, sc := range el.socketCtx {
+		if conn, ok := sc.(*Connection); ok {
+			conns = append(conns, conn)
+		}
+	}
+	return conns
+}
+
 func (el *EventLoop) DeleteInLoop(fd int) {
 	// delete from eventLoop Poll
 	if err := el.Poll.Del(fd); err != nil {
-		fmt.Println("[DeleteFdInLoop]", err)
+		el.logger.Warnf("loop %s: delete fd %d err: %v", el.LoopId, fd, err)
 	}
 
 	// delete from socketContext
 	delete(el.socketCtx, fd)
+	if el.completion != nil && el.eventHandling.Get() {
+		el.deleted = append(el.deleted, fd)
+	}
+}
+
+// 退出事件循环
+// 非本循环协程调用时, 需要唤醒阻塞的 epoll_wait
+func (el *EventLoop) Quit() {
+	el.quit.Set(true)
+	if !el.IsInLoop() {
+		el.wakeup()
+	}
+}
+
+// 调用者是否运行在本事件循环协程中
+func (el *EventLoop) IsInLoop() bool {
+	return el.goId.Get() == goid.Get()
+}
+
+// 在事件循环中执行 cb
+// 若调用者就是本循环协程, 则立即执行; 否则放入队列, 并唤醒事件循环
+func (el *EventLoop) RunInLoop(cb func()) {
+	if el.IsInLoop() {
+		cb()
+	} else {
+		el.QueueInLoop(cb)
+	}
+}
+
+// 将 cb 放入队列, 在本次循环处理完就绪事件后执行
+func (el *EventLoop) QueueInLoop(cb func()) {
+	el.mu.Lock()
+	el.pendingFuncs = append(el.pendingFuncs, cb)
+	el.mu.Unlock()
+
+	// 1. 其他协程调用, 需要唤醒
+	// 2. 正在执行 pendingFuncs 时又加入了新的 cb, 也需要唤醒, 否则要等到下次超时
+	if !el.IsInLoop() || el.callingFuncs.Get() {
+		el.wakeup()
+	}
+}
+
+// 持锁写入, 避免与 Stop 关闭 eventfd 竞争
+func (el *EventLoop) wakeup() {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	if el.stopped {
+		return
+	}
+	if err := el.wakeupFd.wakeup(); err != nil {
+		el.logger.Errorf("loop %s: wakeup err: %v", el.LoopId, err)
+	}
+}
+
+// 执行队列中的 cb
+// 交换出队列后再执行, 缩短临界区, 同时避免 cb 中调用 QueueInLoop 造成死锁
+func (el *EventLoop) doPendingFuncs() {
+	el.callingFuncs.Set(true)
+	el.mu.Lock()
+	funcs := el.pendingFuncs
+	el.pendingFuncs = el.spareFuncs[:0]
+	el.mu.Unlock()
+
+	for i, cb := range funcs {
+		cb()
+		funcs[i] = nil
+	}
+	el.spareFuncs = funcs[:0]
+	el.callingFuncs.Set(false)
+}
+
+// 在 when 时刻执行 cb, 可以在任意协程中调用
+// cb 总是在事件循环协程中执行
+func (el *EventLoop) RunAt(when time.Time, cb func()) TimerId {
+	return el.addTimer(when, 0, cb)
+}
+
+// 在 d 之后执行 cb
+func (el *EventLoop) RunAfter(d time.Duration, cb func()) TimerId {
+	return el.addTimer(time.Now().Add(d), 0, cb)
+}
+
+// 每隔 d 执行一次 cb, 直到被取消
+func (el *EventLoop) RunEvery(d time.Duration, cb func()) TimerId {
+	return el.addTimer(time.Now().Add(d), d, cb)
+}
+
+// 取消定时器, 可以在任意协程中调用
+func (el *EventLoop) Cancel(id TimerId) {
+	if id.t == nil {
+		return
+	}
+	el.RunInLoop(func() {
+		el.timerQueue.cancelTimer(id.t)
+	})
+}
+
+func (el *EventLoop) addTimer(when time.Time, interval time.Duration, cb func()) TimerId {
+	t := &timer{
+		when:     when,
+		interval: interval,
+		cb:       cb,
+		index:    -1,
+	}
+	el.RunInLoop(func() {
+		el.timerQueue.addTimer(t)
+	})
+	return TimerId{t: t}
 }
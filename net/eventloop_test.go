@@ -0,0 +1,291 @@
+package net
+
+import (
+	"bytes"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aizsfgk/mdgo/base/goid"
+	"github.com/aizsfgk/mdgo/net/event"
+	"github.com/aizsfgk/mdgo/net/internal/pollertest"
+	"github.com/aizsfgk/mdgo/net/logger"
+	"github.com/aizsfgk/mdgo/net/poller"
+)
+
+// 启动事件循环, 返回停止函数
+func startTestLoop(t *testing.T) (*EventLoop, func()) {
+	loop, err := NewEventLoop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		loop.Loop()
+		close(done)
+	}()
+	return loop, func() {
+		loop.Quit()
+		<-done
+		_ = loop.Stop()
+	}
+}
+
+func TestEventLoopQueueInLoopWakeup(t *testing.T) {
+	loop, stop := startTestLoop(t)
+	defer stop()
+
+	if loop.IsInLoop() {
+		t.Fatal("test goroutine should not be in loop")
+	}
+
+	inLoop := make(chan bool, 1)
+	begin := time.Now()
+	loop.RunInLoop(func() {
+		inLoop <- loop.IsInLoop()
+	})
+
+	select {
+	case ok := <-inLoop:
+		if !ok {
+			t.Fatal("functor is not run in loop goroutine")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("functor is not run")
+	}
+
+	// 依赖 eventfd 唤醒, 而不是等待 epoll_wait 超时
+	if cost := time.Since(begin); cost >= 500*time.Millisecond {
+		t.Fatalf("wakeup too slow: %v", cost)
+	}
+}
+
+func TestEventLoopPendingFuncsOrder(t *testing.T) {
+	loop, stop := startTestLoop(t)
+	defer stop()
+
+	const n = 1000
+	var got []int
+	finish := make(chan struct{})
+	for i := 0; i < n; i++ {
+		i := i
+		loop.QueueInLoop(func() {
+			got = append(got, i)
+			if i == n-1 {
+				// 循环内再次入队, 应在下一轮执行
+				loop.QueueInLoop(func() { close(finish) })
+			}
+		})
+	}
+
+	select {
+	case <-finish:
+	case <-time.After(5 * time.Second):
+		t.Fatal("pending functors are not run")
+	}
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("got[%d] = %d", i, v)
+		}
+	}
+}
+
+// 第 n 次 Add 失败的轮询器
+type failAddPoller struct {
+	*pollertest.Poller
+	n int
+}
+
+func (p *failAddPoller) Add(fd int, eve event.Event) error {
+	if p.n--; p.n == 0 {
+		return syscall.EBADF
+	}
+	return p.Poller.Add(fd, eve)
+}
+
+// 注册失败时不在 socketCtx 中留下记录, 避免 Stop 再次关闭 fd
+func TestEventLoopAddFailure(t *testing.T) {
+	loop, err := newEventLoopWithPoller(newOption(), &failAddPoller{Poller: pollertest.New(0), n: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loop.Stop()
+
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fds[0])
+	defer syscall.Close(fds[1])
+	if err = loop.AddSocketAndEnableRead(fds[0], &Listener{}); err != syscall.EBADF {
+		t.Fatalf("got %v, want EBADF", err)
+	}
+	if _, ok := loop.socketCtx[fds[0]]; ok {
+		t.Fatal("failed fd is left in socketCtx")
+	}
+
+	// timerfd 注册失败
+	if _, err = newEventLoopWithPoller(newOption(), &failAddPoller{Poller: pollertest.New(0), n: 2}); err != syscall.EBADF {
+		t.Fatalf("got %v, want EBADF", err)
+	}
+}
+
+// 由当前协程驱动的事件循环, 通过 socketpair 与一个回显连接通信
+type echoPair struct {
+	loop *EventLoop
+	conn *Connection
+	peer int
+}
+
+// et 为 true 时连接以边缘触发方式注册
+func newEchoPair(tb testing.TB, et bool, optionCbs ...OptionCallback) *echoPair {
+	loop, err := NewEventLoop(append([]OptionCallback{WithLogger(logger.Nop)}, optionCbs...)...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	loop.goId.Swap(goid.Get())
+
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	conn, _ := NewConnection(fds[0], loop, nil, &testHandler{
+		onMessage: func(conn *Connection, nowUnix int64) {
+			conn.Send(conn.InBuf.PeekAll())
+			conn.InBuf.RetrieveAll()
+		},
+	})
+	conn.edgeTriggered = et
+	if err = conn.register(); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		_ = loop.Stop()
+		_ = syscall.Close(fds[1])
+	})
+	return &echoPair{loop: loop, conn: conn, peer: fds[1]}
+}
+
+// 发送 msg, 运行事件循环直到读回回显
+// 就绪通知一轮即可; 完成式 I/O 下回显的写请求在下一轮提交
+func (p *echoPair) roundTrip(tb testing.TB, msg, buf []byte) {
+	if _, err := syscall.Write(p.peer, msg); err != nil {
+		tb.Fatal(err)
+	}
+	for i := 0; ; i++ {
+		p.loop.loopOnce(1000)
+		n, err := syscall.Read(p.peer, buf)
+		if err == syscall.EAGAIN && i < 3 {
+			continue
+		}
+		if err != nil || !bytes.Equal(buf[:n], msg) {
+			tb.Fatalf("echo: n %d, err %v", n, err)
+		}
+		return
+	}
+}
+
+// 轮询器及触发方式
+type ioMode struct {
+	name   string
+	poller string
+	et     bool
+}
+
+// 创建服务器、客户端及事件循环的选项
+func (m ioMode) options() []OptionCallback {
+	return []OptionCallback{WithPoller(m.poller), EdgeTriggered(m.et)}
+}
+
+// epoll 的水平触发与边缘触发
+var triggerModes = []ioMode{
+	{"LT", poller.Epoll, false},
+	{"ET", poller.Epoll, true},
+}
+
+// 另加 io_uring 完成式 I/O, 内核不支持时为 epoll 水平触发
+var ioModes = append(triggerModes, ioMode{"io_uring", poller.IOUring, false})
+
+func TestEventLoopEchoZeroAlloc(t *testing.T) {
+	for _, mode := range ioModes {
+		t.Run(mode.name, func(t *testing.T) {
+			p := newEchoPair(t, mode.et, WithPoller(mode.poller))
+			// 完成式 I/O 下回显经过输出缓冲, 使用 sync.Pool, -race 下 sync.Pool 会随机丢弃对象
+			if raceEnabled && p.loop.completion != nil {
+				t.Skip("sync.Pool drops objects randomly under -race")
+			}
+			msg := []byte("hello, mdgo")
+			buf := make([]byte, 64)
+
+			p.roundTrip(t, msg, buf) // 预热
+			allocs := testing.AllocsPerRun(1000, func() {
+				p.roundTrip(t, msg, buf)
+			})
+			if allocs != 0 {
+				t.Fatalf("got %v allocs per echo, want 0", allocs)
+			}
+		})
+	}
+}
+
+func BenchmarkEventLoopEcho(b *testing.B) {
+	for _, mode := range ioModes {
+		b.Run(mode.name, func(b *testing.B) {
+			p := newEchoPair(b, mode.et, WithPoller(mode.poller))
+			msg := bytes.Repeat([]byte("x"), 512)
+			buf := make([]byte, len(msg))
+
+			b.ReportAllocs()
+			b.SetBytes(int64(len(msg)))
+			for i := 0; i < b.N; i++ {
+				p.roundTrip(b, msg, buf)
+			}
+		})
+	}
+}
+
+// io_uring 可用时连接使用完成式 I/O, 其他轮询器使用就绪通知; 回显结果相同
+func TestEventLoopEchoPollers(t *testing.T) {
+	for _, name := range []string{poller.Epoll, poller.Poll, poller.IOUring} {
+		t.Run(name, func(t *testing.T) {
+			p := newEchoPair(t, false, WithPoller(name))
+			_, isUring := p.loop.Poll.(poller.CompletionPoller)
+			if p.conn.completion != isUring {
+				t.Fatalf("completion %v, poller %T", p.conn.completion, p.loop.Poll)
+			}
+			if name != poller.IOUring && isUring {
+				t.Fatalf("poller %s supports completion", name)
+			}
+
+			buf := make([]byte, 64*1024)
+			for _, msg := range [][]byte{[]byte("ping"), bytes.Repeat([]byte("x"), 32*1024)} {
+				if _, err := syscall.Write(p.peer, msg); err != nil {
+					t.Fatal(err)
+				}
+				var got []byte
+				for i := 0; len(got) < len(msg) && i < 100; i++ {
+					p.loop.loopOnce(10)
+					got = append(got, drain(t, p.peer, buf)...)
+				}
+				if !bytes.Equal(got, msg) {
+					t.Fatalf("got %d bytes, want %d", len(got), len(msg))
+				}
+			}
+		})
+	}
+}
+
+// 完成式 I/O 没有触发方式之分, 忽略边缘触发并输出告警
+func TestEventLoopCompletionIgnoresEdgeTriggered(t *testing.T) {
+	log := &recordLogger{}
+	p := newEchoPair(t, true, WithPoller(poller.IOUring), WithLogger(log))
+	if p.loop.completion == nil {
+		t.Skip("io_uring is unavailable")
+	}
+	if p.conn.edgeTriggered || !log.contains("WARN") {
+		t.Fatalf("edge-triggered %v, warn logged %v", p.conn.edgeTriggered, log.contains("WARN"))
+	}
+
+	msg := []byte("ping")
+	p.roundTrip(t, msg, make([]byte, len(msg)))
+}
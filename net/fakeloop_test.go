@@ -0,0 +1,478 @@
+package net
+
+import (
+	"bytes"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/aizsfgk/mdgo/base/goid"
+	"github.com/aizsfgk/mdgo/net/event"
+	"github.com/aizsfgk/mdgo/net/internal/pollertest"
+)
+
+const fakeNow = 1600000000
+
+// 使用内存轮询器的事件循环, 由测试协程逐轮驱动
+// 就绪事件只来自 Inject, 不依赖内核通知的时机
+type fakeLoop struct {
+	loop *EventLoop
+	poll *pollertest.Poller
+	log  *recordLogger
+}
+
+func newFakeLoop(t *testing.T) *fakeLoop {
+	poll := pollertest.New(fakeNow)
+	log := &recordLogger{}
+	opt := newOption(WithLogger(log))
+	loop, err := newEventLoopWithPoller(opt, poll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loop.goId.Swap(goid.Get())
+	t.Cleanup(func() { _ = loop.Stop() })
+	return &fakeLoop{loop: loop, poll: poll, log: log}
+}
+
+// 在 socketpair 的一端上建立连接并注册, 返回连接及对端 fd
+func (f *fakeLoop) newConn(t *testing.T, h *testHandler, et bool) (*Connection, int) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = syscall.Close(fds[1]) })
+	return f.register(t, fds[0], h, et), fds[1]
+}
+
+// 在本地 tcp 连接的一端上建立连接并注册, 然后对端发送 RST, 返回时连接上已有待处理的 ECONNRESET
+func (f *fakeLoop) newResetConn(t *testing.T, h *testHandler, et bool) *Connection {
+	lfd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(lfd)
+	if err = syscall.Bind(lfd, &syscall.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = syscall.Listen(lfd, 1); err != nil {
+		t.Fatal(err)
+	}
+	sa, err := syscall.Getsockname(lfd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peer, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = syscall.SetsockoptLinger(peer, syscall.SOL_SOCKET, syscall.SO_LINGER, &syscall.Linger{Onoff: 1})
+	if err == nil {
+		err = syscall.Connect(peer, sa)
+	}
+	if err != nil {
+		_ = syscall.Close(peer)
+		t.Fatal(err)
+	}
+	fd, _, err := syscall.Accept4(lfd, syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC)
+	// SO_LINGER 为 0 时 close 发送 RST
+	_ = syscall.Close(peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := f.register(t, fd, h, et)
+	waitSocketError(t, fd)
+	return conn
+}
+
+func (f *fakeLoop) register(t *testing.T, fd int, h *testHandler, et bool) *Connection {
+	conn, err := NewConnection(fd, f.loop, nil, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.edgeTriggered = et
+	if err = conn.register(); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// 新建监听 127.0.0.1 随机端口的监听器并注册, 接收的新连接 fd 追加到 accepted, 测试结束时关闭
+func (f *fakeLoop) newListener(t *testing.T, accepted *[]int) *Listener {
+	l, err := NewListener("tcp", "127.0.0.1:0", false, f.loop, func(fd int, sa syscall.Sockaddr) error {
+		*accepted = append(*accepted, fd)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = l.Close()
+		for _, fd := range *accepted {
+			_ = syscall.Close(fd)
+		}
+	})
+	if err = l.register(); err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// 注入就绪事件并运行一轮事件循环
+func (f *fakeLoop) step(fd int, ev event.Event) {
+	f.poll.Inject(fd, ev)
+	f.loop.loopOnce(0)
+}
+
+func (f *fakeLoop) wantEvents(t *testing.T, fd int, want event.Event) {
+	t.Helper()
+	ev, ok := f.poll.Events(fd)
+	if !ok {
+		t.Fatalf("fd %d is not registered", fd)
+	}
+	if ev != want {
+		t.Fatalf("fd %d: events %v, want %v", fd, ev, want)
+	}
+}
+
+// 等待 fd 上的套接字错误, epoll 等待不会清除 SO_ERROR
+func waitSocketError(t *testing.T, fd int) {
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(epfd)
+	if err = syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, fd, &syscall.EpollEvent{Events: syscall.EPOLLERR, Fd: int32(fd)}); err != nil {
+		t.Fatal(err)
+	}
+	evs := make([]syscall.EpollEvent, 1)
+	for {
+		n, err := syscall.EpollWait(epfd, evs, 5000)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			t.Fatal("wait socket error timeout")
+		}
+		return
+	}
+}
+
+// 读出对端接收缓冲中的全部数据
+func drain(t *testing.T, fd int, buf []byte) []byte {
+	var got []byte
+	for {
+		n, err := syscall.Read(fd, buf)
+		if err == syscall.EAGAIN {
+			return got
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, buf[:n]...)
+	}
+}
+
+// 内核缓冲写满时剩余数据留在 OutBuf, 关注写事件, 每次可写时继续写出
+func TestFakeLoopPartialWrite(t *testing.T) {
+	f := newFakeLoop(t)
+	completed := 0
+	conn, peer := f.newConn(t, &testHandler{onWriteComplete: func() { completed++ }}, false)
+	if err := setSendBuffer(conn.Fd(), 4096); err != nil {
+		t.Fatal(err)
+	}
+
+	payload := bytes.Repeat([]byte("partial write "), 64*1024)
+	if err := conn.Send(payload); err != nil {
+		t.Fatal(err)
+	}
+	if conn.OutBuf.ReadableBytes() == 0 {
+		t.Fatal("payload is written at once")
+	}
+	f.wantEvents(t, conn.Fd(), event.EventRead|event.EventWrite)
+
+	// 未注入可写事件时不会继续写
+	buf := make([]byte, 64*1024)
+	got := drain(t, peer, buf)
+	queued := conn.OutBuf.ReadableBytes()
+	f.loop.loopOnce(0)
+	if conn.OutBuf.ReadableBytes() != queued {
+		t.Fatal("OutBuf is flushed without a write event")
+	}
+
+	for i := 0; conn.OutBuf.ReadableBytes() > 0; i++ {
+		if i > len(payload) {
+			t.Fatal("OutBuf is not flushed")
+		}
+		f.step(conn.Fd(), event.EventWrite)
+		got = append(got, drain(t, peer, buf)...)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Fatalf("got %d bytes, want %d", len(got), len(payload))
+	}
+	if completed != 1 {
+		t.Fatalf("OnWriteComplete called %d times", completed)
+	}
+	f.wantEvents(t, conn.Fd(), event.EventRead)
+}
+
+// 没有数据时的读事件: read 返回 EAGAIN, 连接保持不变
+func TestFakeLoopReadEAGAIN(t *testing.T) {
+	for _, mode := range triggerModes {
+		t.Run(mode.name, func(t *testing.T) {
+			f := newFakeLoop(t)
+			messages := 0
+			conn, peer := f.newConn(t, &testHandler{
+				onMessage: func(conn *Connection, nowUnix int64) {
+					messages++
+					conn.InBuf.RetrieveAll()
+				},
+			}, mode.et)
+			if f.poll.EdgeTriggered(conn.Fd()) != mode.et {
+				t.Fatalf("edge-triggered %v, want %v", f.poll.EdgeTriggered(conn.Fd()), mode.et)
+			}
+
+			f.step(conn.Fd(), event.EventRead)
+			if messages != 0 || !conn.connected.Get() {
+				t.Fatalf("messages %d, connected %v", messages, conn.connected.Get())
+			}
+
+			if _, err := syscall.Write(peer, []byte("ping")); err != nil {
+				t.Fatal(err)
+			}
+			f.step(conn.Fd(), event.EventRead)
+			if messages != 1 {
+				t.Fatalf("messages %d, want 1", messages)
+			}
+		})
+	}
+}
+
+// 对端关闭写: 读到 EOF 后关闭连接并从轮询器中删除
+func TestFakeLoopRDHUP(t *testing.T) {
+	for _, mode := range triggerModes {
+		t.Run(mode.name, func(t *testing.T) {
+			f := newFakeLoop(t)
+			var msg []byte
+			closed := 0
+			conn, peer := f.newConn(t, &testHandler{
+				onMessage: func(conn *Connection, nowUnix int64) {
+					msg = append(msg, conn.InBuf.PeekAll()...)
+					conn.InBuf.RetrieveAll()
+				},
+				onClose: func() { closed++ },
+			}, mode.et)
+			fd := conn.Fd()
+
+			if _, err := syscall.Write(peer, []byte("bye")); err != nil {
+				t.Fatal(err)
+			}
+			_ = syscall.Shutdown(peer, syscall.SHUT_WR)
+
+			// 水平触发每个事件只读一次, 再次通知时读到 EOF
+			f.step(fd, event.EventRead)
+			if !mode.et {
+				f.step(fd, event.EventRead)
+			}
+			if string(msg) != "bye" || closed != 1 || conn.connected.Get() {
+				t.Fatalf("msg %q, closed %d, connected %v", msg, closed, conn.connected.Get())
+			}
+			if _, ok := f.poll.Events(fd); ok {
+				t.Fatal("closed connection is still registered")
+			}
+			if _, ok := f.loop.socketCtx[fd]; ok {
+				t.Fatal("closed connection is still in the loop")
+			}
+		})
+	}
+}
+
+// 错误事件但 SO_ERROR 为 0: 连接保持不变, 同时到达的读事件照常处理
+func TestFakeLoopErrorEventNoError(t *testing.T) {
+	f := newFakeLoop(t)
+	messages := 0
+	conn, peer := f.newConn(t, &testHandler{
+		onMessage: func(conn *Connection, nowUnix int64) {
+			messages++
+			conn.InBuf.RetrieveAll()
+		},
+	}, false)
+
+	if _, err := syscall.Write(peer, []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	f.step(conn.Fd(), event.EventError|event.EventRead)
+	if messages != 1 || !conn.connected.Get() {
+		t.Fatalf("messages %d, connected %v", messages, conn.connected.Get())
+	}
+	if f.log.contains("ERROR") {
+		t.Fatal("error is logged without SO_ERROR")
+	}
+}
+
+// 对端重置连接: 错误事件读到 SO_ERROR(ECONNRESET) 后记录并关闭连接
+func TestFakeLoopErrorEventReset(t *testing.T) {
+	f := newFakeLoop(t)
+	messages, closed := 0, 0
+	conn := f.newResetConn(t, &testHandler{
+		onMessage: func(conn *Connection, nowUnix int64) { messages++ },
+		onClose:   func() { closed++ },
+	}, false)
+	fd := conn.Fd()
+
+	f.step(fd, event.EventError|event.EventRead)
+	if closed != 1 || messages != 0 || conn.connected.Get() {
+		t.Fatalf("closed %d, messages %d, connected %v", closed, messages, conn.connected.Get())
+	}
+	if !f.log.contains("ERROR TcpConnection::handleError") {
+		t.Fatal("socket error is not logged")
+	}
+	if _, ok := f.loop.socketCtx[fd]; ok {
+		t.Fatal("closed connection is still in the loop")
+	}
+}
+
+// 读出错(ECONNRESET): 关闭连接并从轮询器中删除, 边缘触发下不会再有事件
+func TestFakeLoopReadError(t *testing.T) {
+	for _, mode := range triggerModes {
+		t.Run(mode.name, func(t *testing.T) {
+			f := newFakeLoop(t)
+			closed := 0
+			conn := f.newResetConn(t, &testHandler{onClose: func() { closed++ }}, mode.et)
+			fd := conn.Fd()
+
+			f.step(fd, event.EventRead)
+			if closed != 1 || conn.connected.Get() {
+				t.Fatalf("closed %d, connected %v", closed, conn.connected.Get())
+			}
+			if _, ok := f.poll.Events(fd); ok {
+				t.Fatal("closed connection is still registered")
+			}
+		})
+	}
+}
+
+// 对端已关闭时写出失败(EPIPE), 关闭连接并释放未发送的数据
+func TestFakeLoopWriteError(t *testing.T) {
+	f := newFakeLoop(t)
+	closed := 0
+	conn, peer := f.newConn(t, &testHandler{onClose: func() { closed++ }}, false)
+	if err := setSendBuffer(conn.Fd(), 4096); err != nil {
+		t.Fatal(err)
+	}
+
+	var sendErr error
+	if err := conn.SendOwned(make([]byte, 1024*1024), func(err error) { sendErr = err }); err != nil {
+		t.Fatal(err)
+	}
+	f.wantEvents(t, conn.Fd(), event.EventRead|event.EventWrite)
+
+	_ = syscall.Close(peer)
+	f.step(conn.Fd(), event.EventWrite)
+	if closed != 1 || conn.connected.Get() {
+		t.Fatalf("closed %d, connected %v", closed, conn.connected.Get())
+	}
+	if sendErr == nil {
+		t.Fatal("unsent data is not released with an error")
+	}
+}
+
+// 连接的活跃时间取自 Poll 返回的时间戳
+func TestFakeLoopClock(t *testing.T) {
+	f := newFakeLoop(t)
+	var stamps []int64
+	conn, peer := f.newConn(t, &testHandler{
+		onMessage: func(conn *Connection, nowUnix int64) {
+			stamps = append(stamps, nowUnix)
+			conn.InBuf.RetrieveAll()
+		},
+	}, false)
+
+	for i := 0; i < 2; i++ {
+		if _, err := syscall.Write(peer, []byte("tick")); err != nil {
+			t.Fatal(err)
+		}
+		f.step(conn.Fd(), event.EventRead)
+		f.poll.Advance(30)
+	}
+	if len(stamps) != 2 || stamps[0] != fakeNow || stamps[1] != fakeNow+30 {
+		t.Fatalf("nowUnix %v", stamps)
+	}
+	if conn.activeTime.Get() != fakeNow+30 {
+		t.Fatalf("activeTime %d, want %d", conn.activeTime.Get(), fakeNow+30)
+	}
+}
+
+// 监听套接字可读: 接收一个连接; 没有待接收的连接时 accept 返回 EAGAIN, 忽略
+func TestFakeLoopListenerAccept(t *testing.T) {
+	f := newFakeLoop(t)
+	var accepted []int
+	l := f.newListener(t, &accepted)
+	f.wantEvents(t, l.Fd(), event.EventRead)
+
+	f.step(l.Fd(), event.EventRead)
+	if len(accepted) != 0 || f.log.contains("ERROR") {
+		t.Fatalf("accepted %d, error logged %v", len(accepted), f.log.contains("ERROR"))
+	}
+
+	cli, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	f.step(l.Fd(), event.EventRead)
+	if len(accepted) != 1 {
+		t.Fatalf("accepted %d, want 1", len(accepted))
+	}
+	sa, err := syscall.Getpeername(accepted[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port := sa.(*syscall.SockaddrInet4).Port; port != cli.LocalAddr().(*net.TCPAddr).Port {
+		t.Fatalf("peer port %d, want %d", port, cli.LocalAddr().(*net.TCPAddr).Port)
+	}
+}
+
+// fd 用尽时 accept 返回 EMFILE, 连接留在全连接队列中, fd 可用后再次可读时接收
+func TestFakeLoopListenerAcceptEMFILE(t *testing.T) {
+	f := newFakeLoop(t)
+	var accepted []int
+	l := f.newListener(t, &accepted)
+
+	cli, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	// 最小的空闲 fd 即为上限, 之后分配 fd 返回 EMFILE
+	var lim syscall.Rlimit
+	if err = syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+		t.Fatal(err)
+	}
+	free, err := syscall.Dup(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = syscall.Close(free)
+	low := lim
+	low.Cur = uint64(free)
+	if err = syscall.Setrlimit(syscall.RLIMIT_NOFILE, &low); err != nil {
+		t.Skip(err)
+	}
+	err = l.HandleEvent(event.EventRead, fakeNow)
+	if rerr := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &lim); rerr != nil {
+		t.Fatal(rerr)
+	}
+	if err != syscall.EMFILE || len(accepted) != 0 {
+		t.Fatalf("accept err %v, accepted %d", err, len(accepted))
+	}
+
+	f.step(l.Fd(), event.EventRead)
+	if len(accepted) != 1 {
+		t.Fatalf("accepted %d, want 1", len(accepted))
+	}
+}
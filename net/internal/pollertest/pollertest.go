@@ -0,0 +1,200 @@
+// 确定性的内存轮询器, 用于单元测试
+//
+// Poll 从不阻塞, 只返回测试通过 Inject 注入的就绪事件, 时间戳由 SetNow/Advance 控制;
+// 配合 socketpair 及逐轮驱动事件循环, 可以不依赖时序地测试部分写出、EAGAIN、RDHUP 及出错等路径
+// 逐轮驱动事件循环的接口(newEventLoopWithPoller、loopOnce)未导出, 因此放在 internal 下, 只供 net 包的测试使用
+package pollertest
+
+import (
+	"sync"
+	"syscall"
+
+	mdgoErr "github.com/aizsfgk/mdgo/net/errors"
+	"github.com/aizsfgk/mdgo/net/event"
+	"github.com/aizsfgk/mdgo/net/poller"
+)
+
+var (
+	_ poller.Poller              = (*Poller)(nil)
+	_ poller.EdgeTriggeredPoller = (*Poller)(nil)
+)
+
+// 注册的 fd
+type fdState struct {
+	events event.Event // 关注的事件
+	edge   bool        // 以边缘触发方式注册
+}
+
+// 内存轮询器, 可以在任意协程中调用
+type Poller struct {
+	mu      sync.Mutex
+	fds     map[int]fdState     // fd -> 状态
+	pending []event.EventHolder // 注入的就绪事件, 下一次 Poll 时返回
+	now     int64               // Poll 返回的时间戳
+	ctls    int                 // Add/Del/Enable* 调用次数
+	closed  bool
+}
+
+// 新建轮询器, 时间戳为 now
+func New(now int64) *Poller {
+	return &Poller{
+		fds: make(map[int]fdState),
+		now: now,
+	}
+}
+
+// ***************** 测试控制 ***************** //
+
+// 注入就绪事件, 下一次 Poll 时返回
+// 与内核一致, 只返回 fd 关注的读写事件, EventError 总会返回; 未注册的 fd 被忽略
+func (p *Poller) Inject(fd int, ev event.Event) {
+	p.mu.Lock()
+	p.pending = append(p.pending, event.EventHolder{Fd: fd, Revent: ev})
+	p.mu.Unlock()
+}
+
+// 设置 Poll 返回的时间戳
+func (p *Poller) SetNow(now int64) {
+	p.mu.Lock()
+	p.now = now
+	p.mu.Unlock()
+}
+
+// 时间戳前进 sec 秒
+func (p *Poller) Advance(sec int64) {
+	p.mu.Lock()
+	p.now += sec
+	p.mu.Unlock()
+}
+
+func (p *Poller) Now() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.now
+}
+
+// fd 关注的事件, 未注册时 ok 为 false
+func (p *Poller) Events(fd int) (ev event.Event, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st, ok := p.fds[fd]
+	return st.events, ok
+}
+
+// fd 是否以边缘触发方式注册
+func (p *Poller) EdgeTriggered(fd int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.fds[fd].edge
+}
+
+// Add/Del/Enable* 的调用次数, 对应 epoll_ctl 的次数
+func (p *Poller) Ctls() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.ctls
+}
+
+func (p *Poller) Closed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+// ***************** poller.Poller ***************** //
+
+func (p *Poller) Add(fd int, eve event.Event) error {
+	var events event.Event
+
+	if eve&event.EventRead != 0 {
+		events = event.EventRead
+	} else if eve&event.EventWrite != 0 {
+		events = event.EventWrite
+	} else {
+		return mdgoErr.EventIsNil
+	}
+	return p.add(fd, fdState{events: events})
+}
+
+func (p *Poller) AddEdgeTriggered(fd int) error {
+	return p.add(fd, fdState{events: event.EventRead | event.EventWrite, edge: true})
+}
+
+func (p *Poller) add(fd int, st fdState) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ctls++
+	if _, ok := p.fds[fd]; ok {
+		return syscall.EEXIST
+	}
+	p.fds[fd] = st
+	return nil
+}
+
+func (p *Poller) Del(fd int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ctls++
+	if _, ok := p.fds[fd]; !ok {
+		return syscall.ENOENT
+	}
+	delete(p.fds, fd)
+	return nil
+}
+
+func (p *Poller) mod(fd int, events event.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ctls++
+	st, ok := p.fds[fd]
+	if !ok {
+		return syscall.ENOENT
+	}
+	st.events = events
+	p.fds[fd] = st
+	return nil
+}
+
+func (p *Poller) EnableRead(fd int) error {
+	return p.mod(fd, event.EventRead)
+}
+
+func (p *Poller) EnableWrite(fd int) error {
+	return p.mod(fd, event.EventWrite)
+}
+
+func (p *Poller) EnableReadWrite(fd int) error {
+	return p.mod(fd, event.EventRead|event.EventWrite)
+}
+
+// 返回注入的事件, 不阻塞, 忽略 msec
+func (p *Poller) Poll(msec int, acp *[]event.EventHolder) (int64, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(*acp) < len(p.pending) {
+		*acp = make([]event.EventHolder, len(p.pending))
+	}
+	n := 0
+	for _, ev := range p.pending {
+		st, ok := p.fds[ev.Fd]
+		if !ok {
+			continue
+		}
+		ev.Revent &= st.events | event.EventError
+		if ev.Revent == event.EventNone {
+			continue
+		}
+		(*acp)[n] = ev
+		n++
+	}
+	p.pending = p.pending[:0]
+	return p.now, n
+}
+
+func (p *Poller) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	return nil
+}
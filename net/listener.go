@@ -1,7 +1,7 @@
 package net
 
 import (
-	"fmt"
+	"context"
 	"net"
 	"os"
 	"syscall"
@@ -28,7 +28,13 @@ func NewListener(network, addr string, reusePort bool, loop *EventLoop, handleCo
 		ok          bool
 	)
 
-	listener, err = net.Listen(network, addr)
+	if reusePort {
+		// 多个监听套接字绑定同一地址, 由内核进行负载均衡
+		lc := net.ListenConfig{Control: controlReusePort}
+		listener, err = lc.Listen(context.Background(), network, addr)
+	} else {
+		listener, err = net.Listen(network, addr)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -43,7 +49,7 @@ func NewListener(network, addr string, reusePort bool, loop *EventLoop, handleCo
 	}
 
 	fd := int(file.Fd())
-	fmt.Println("*** new listenerFd: ", fd, "***")
+	loop.logger.Debugf("new listener fd: %d, addr: %s", fd, listener.Addr())
 	if err = syscall.SetNonblock(fd, true); err != nil {
 		return nil, err
 	}
@@ -67,18 +73,46 @@ func (l *Listener) HandleEvent(eve event.Event, nowUnix int64) error {
 			}
 			return err
 		}
-		fmt.Println("*** new connFd: ", connFd, "***")
+		l.loop.logger.Debugf("listener fd %d: accept fd: %d", l.listenFd, connFd)
 		// start handle new connection
 		return l.handleNewConn(connFd, sa)
 	}
 	return nil
 }
 
+// 注册到事件循环, 轮询器支持完成式 I/O 时提交 accept 请求, 否则关注读事件
+func (l *Listener) register() error {
+	if l.loop.completion != nil {
+		return l.registerCompletion()
+	}
+	return l.loop.AddSocketAndEnableRead(l.listenFd, l)
+}
+
 func (l *Listener) Fd() int {
 	return l.listenFd
 }
 
+// 监听地址, 监听端口为0时可获取实际端口
+func (l *Listener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// 停止监听, 需在事件循环中调用
+// listenFd 由 file 持有, 通过 file 关闭, 同时关闭原始的 net.Listener 释放端口
 func (l *Listener) Close() error {
 	l.loop.DeleteInLoop(l.listenFd)
-	return syscall.Close(l.listenFd)
+	_ = l.listener.Close()
+	return l.file.Close()
+}
+
+// 设置 SO_REUSEPORT, 需要在 bind 之前
+func controlReusePort(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return os.NewSyscallError("setsockopt", sockErr)
 }
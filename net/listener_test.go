@@ -0,0 +1,77 @@
+package net
+
+import (
+	"net"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestServerReusePortAllLoops(t *testing.T) {
+	numLoop := runtime.NumCPU()
+	if numLoop < 2 {
+		t.Skip("reusePort mode needs at least 2 sub eventLoops")
+	}
+	if numLoop > 4 {
+		numLoop = 4
+	}
+
+	const connNum = 64
+	var (
+		mu     sync.Mutex
+		loops  = make(map[*EventLoop]int)
+		connWg sync.WaitGroup
+	)
+	connWg.Add(connNum)
+	serv := startTestServer(t, &testHandler{
+		onConnection: func(conn *Connection) {
+			if !conn.Loop().IsInLoop() {
+				t.Error("OnConnection is not run in connection's loop")
+			}
+			mu.Lock()
+			loops[conn.Loop()]++
+			mu.Unlock()
+			connWg.Done()
+		},
+	}, ReusePort(true), NumLoop(numLoop))
+
+	if len(serv.listeners) != numLoop {
+		t.Fatalf("got %d listeners, want %d", len(serv.listeners), numLoop)
+	}
+	for _, l := range serv.listeners {
+		if l.Addr().String() != serv.Addr().String() {
+			t.Fatalf("listener addr %s, want %s", l.Addr(), serv.Addr())
+		}
+	}
+
+	for i := 0; i < connNum; i++ {
+		cli, err := net.Dial("tcp", serv.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cli.Close()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		connWg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not all connections are accepted")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, loop := range serv.workLoops {
+		if loops[loop] == 0 {
+			t.Errorf("no connection lands on %s: %v", loop.LoopId, loops)
+		}
+	}
+	if loops[serv.mainLoop] != 0 {
+		t.Errorf("mainReactor should not accept connections in reusePort mode")
+	}
+}
@@ -0,0 +1,66 @@
+package logger
+
+import (
+	"fmt"
+	stdlog "log"
+	"os"
+
+	"github.com/aizsfgk/mdgo/base/log"
+)
+
+// net 及 poller 输出日志使用的接口, 可接入任意日志库
+// 实现需保证并发安全
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+var _ Logger = (*log.Logger)(nil)
+
+type nop struct{}
+
+func (nop) Debugf(string, ...interface{}) {}
+func (nop) Infof(string, ...interface{})  {}
+func (nop) Warnf(string, ...interface{})  {}
+func (nop) Errorf(string, ...interface{}) {}
+
+// 丢弃所有日志, 未设置 WithLogger 时的默认值
+var Nop Logger = nop{}
+
+type stdLogger struct {
+	l     *stdlog.Logger
+	level log.Level
+}
+
+// 适配标准库 log, 低于 level 的日志被丢弃; l 为 nil 时输出到 os.Stderr
+func NewStd(l *stdlog.Logger, level log.Level) Logger {
+	if l == nil {
+		l = stdlog.New(os.Stderr, "", stdlog.LstdFlags)
+	}
+	return &stdLogger{l: l, level: level}
+}
+
+func (s *stdLogger) output(level log.Level, format string, args []interface{}) {
+	if level < s.level {
+		return
+	}
+	_ = s.l.Output(3, "["+level.String()+"] "+fmt.Sprintf(format, args...))
+}
+
+func (s *stdLogger) Debugf(format string, args ...interface{}) {
+	s.output(log.DebugLevel, format, args)
+}
+
+func (s *stdLogger) Infof(format string, args ...interface{}) {
+	s.output(log.InfoLevel, format, args)
+}
+
+func (s *stdLogger) Warnf(format string, args ...interface{}) {
+	s.output(log.WarnLevel, format, args)
+}
+
+func (s *stdLogger) Errorf(format string, args ...interface{}) {
+	s.output(log.ErrorLevel, format, args)
+}
@@ -0,0 +1,23 @@
+package logger
+
+import (
+	"bytes"
+	stdlog "log"
+	"testing"
+
+	"github.com/aizsfgk/mdgo/base/log"
+)
+
+func TestStd(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewStd(stdlog.New(&buf, "", stdlog.Lshortfile), log.InfoLevel)
+	l.Debugf("dropped %d", 1)
+	l.Infof("accept fd: %d", 7)
+	l.Errorf("close err: %v", "EBADF")
+
+	want := "logger_test.go:15: [INFO] accept fd: 7\n" +
+		"logger_test.go:16: [ERROR] close err: EBADF\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
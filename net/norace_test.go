@@ -0,0 +1,5 @@
+// +build !race
+
+package net
+
+const raceEnabled = false
@@ -1,20 +1,63 @@
 package net
 
-import "time"
+import (
+	"time"
+
+	"github.com/aizsfgk/mdgo/net/logger"
+)
+
+// 日志接口, 可通过 WithLogger 接入自定义的日志库
+type Logger = logger.Logger
 
 type Option struct {
 	Network string
 	Addr    string
 
-	NumLoop   int
-	ReusePort bool
-	KeepAlive time.Duration
+	NumLoop     int
+	ReusePort   bool
+	IdleTimeout time.Duration // 空闲超时, 0 表示不检测
+	Codec       Codec         // 编解码器, nil 表示使用原始的 OnMessage
+
+	// 日志, 默认为 logger.Nop 不输出; 可设为 base/log 的 log.Default() 等
+	Logger Logger
+
+	// Shutdown 时不主动关闭连接, 等待业务或对端关闭, 直到超时
+	WaitConnClose bool
+
+	// 输出缓冲高水位, 达到时回调 OnHighWaterMark, 0 表示不检测
+	// 之后降至低水位及以下时回调 OnLowWaterMark, 低水位应小于高水位
+	HighWaterMark int
+	LowWaterMark  int
+
+	// 轮询器, poller.Epoll、poller.Poll 或 poller.IOUring, 为空时使用环境变量 MDGO_POLLER 或平台默认(linux 下为 epoll)
+	// io_uring 下连接使用完成式 I/O, 内核不支持时使用 epoll
+	Poller string
+
+	// 已连接套接字使用边缘触发(EPOLLET), 读写事件一次注册, 读写到 EAGAIN 为止; 完成式 I/O 下忽略
+	EdgeTriggered bool
+
+	// 客户端连接超时, 0 表示不限制
+	ConnectTimeout time.Duration
+
+	// 客户端重连策略, nil 表示不重连
+	Retry *RetryPolicy
+
+	// 已连接套接字选项
+	KeepAlive   time.Duration // SO_KEEPALIVE, 空闲及探测间隔, 0 表示不设置
+	NoDelay     bool          // TCP_NODELAY
+	RecvBuf     int           // SO_RCVBUF, 0 表示系统默认
+	SendBuf     int           // SO_SNDBUF, 0 表示系统默认
+	Linger      int           // SO_LINGER 秒, 小于0 表示不设置
+	UserTimeout time.Duration // TCP_USER_TIMEOUT, 0 表示不设置
+	QuickAck    bool          // TCP_QUICKACK
 }
 
 type OptionCallback func(*Option)
 
 func newOption(optCb ...OptionCallback) *Option {
-	opt := Option{}
+	opt := Option{
+		Linger: -1,
+	}
 
 	for _, cb := range optCb {
 		cb(&opt)
@@ -28,6 +71,10 @@ func newOption(optCb ...OptionCallback) *Option {
 		opt.Addr = ":19292"
 	}
 
+	if opt.Logger == nil {
+		opt.Logger = logger.Nop
+	}
+
 	return &opt
 }
 
@@ -60,3 +107,99 @@ func KeepAlive(ka time.Duration) OptionCallback {
 		o.KeepAlive = ka
 	}
 }
+
+func IdleTimeout(d time.Duration) OptionCallback {
+	return func(o *Option) {
+		o.IdleTimeout = d
+	}
+}
+
+func NoDelay(noDelay bool) OptionCallback {
+	return func(o *Option) {
+		o.NoDelay = noDelay
+	}
+}
+
+func RecvBuf(bytes int) OptionCallback {
+	return func(o *Option) {
+		o.RecvBuf = bytes
+	}
+}
+
+func SendBuf(bytes int) OptionCallback {
+	return func(o *Option) {
+		o.SendBuf = bytes
+	}
+}
+
+func Linger(sec int) OptionCallback {
+	return func(o *Option) {
+		o.Linger = sec
+	}
+}
+
+func UserTimeout(d time.Duration) OptionCallback {
+	return func(o *Option) {
+		o.UserTimeout = d
+	}
+}
+
+func QuickAck(quickAck bool) OptionCallback {
+	return func(o *Option) {
+		o.QuickAck = quickAck
+	}
+}
+
+func WaitConnClose(wait bool) OptionCallback {
+	return func(o *Option) {
+		o.WaitConnClose = wait
+	}
+}
+
+func HighWaterMark(bytes int) OptionCallback {
+	return func(o *Option) {
+		o.HighWaterMark = bytes
+	}
+}
+
+func LowWaterMark(bytes int) OptionCallback {
+	return func(o *Option) {
+		o.LowWaterMark = bytes
+	}
+}
+
+func WithPoller(name string) OptionCallback {
+	return func(o *Option) {
+		o.Poller = name
+	}
+}
+
+func EdgeTriggered(et bool) OptionCallback {
+	return func(o *Option) {
+		o.EdgeTriggered = et
+	}
+}
+
+func ConnectTimeout(d time.Duration) OptionCallback {
+	return func(o *Option) {
+		o.ConnectTimeout = d
+	}
+}
+
+func Reconnect(policy RetryPolicy) OptionCallback {
+	return func(o *Option) {
+		o.Retry = &policy
+	}
+}
+
+func WithCodec(c Codec) OptionCallback {
+	return func(o *Option) {
+		o.Codec = c
+	}
+}
+
+func WithLogger(l Logger) OptionCallback {
+	return func(o *Option) {
+		o.Logger = l
+	}
+}
@@ -0,0 +1,320 @@
+package net
+
+import (
+	"syscall"
+
+	"github.com/aizsfgk/mdgo/base/atomic"
+	mdgoErr "github.com/aizsfgk/mdgo/net/errors"
+	"github.com/aizsfgk/mdgo/net/event"
+)
+
+const (
+	pipeSize    = 64 * 1024 // 每次 splice 的最大长度, 即内核管道的默认容量
+	spliceFlags = 0x1 | 0x2 // SPLICE_F_MOVE | SPLICE_F_NONBLOCK
+)
+
+// 两个连接之间的双向转发
+// 数据通过 splice(2) 经内核管道在两个套接字之间移动, 不拷贝到用户态
+// 一端读到 EOF 后, 把管道中的数据发完再 shutdown 另一端的写;
+// 两个方向都结束后关闭两个连接, 任一端出错或被关闭时另一端也随之关闭
+type Pipe struct {
+	conn   *Connection // 调用 Pipe 的连接
+	other  *Connection // 对端连接
+	out    pipeHalf    // conn -> other
+	in     pipeHalf    // other -> conn
+	closed bool        // 已关闭
+}
+
+// 一个方向的转发
+type pipeHalf struct {
+	src     *Connection  // 读端连接
+	dst     *Connection  // 写端连接
+	fds     [2]int       // 内核管道, fds[0] 读, fds[1] 写
+	pending int          // 管道中尚未写入 dst 的字节数
+	eof     bool         // src 已读到 EOF
+	shut    bool         // 已 shutdown dst 的写
+	bytes   atomic.Int64 // 已转发的字节数
+}
+
+// 将 conn 与 other 对接, 之后两端收到的数据直接转发给对方
+// 对接后不再回调 OnMessage, 也不能再 Send; InBuf 中尚未处理的数据先发给对端
+// 两个连接需属于同一个事件循环, 例如在 OnConnection 中以 conn.Loop() 创建 Client,
+// 连接建立后调用 Pipe; 可以在任意协程中调用, 非本循环协程调用时在事件循环中异步对接
+func (conn *Connection) Pipe(other *Connection) (*Pipe, error) {
+	if conn.eventLoop != other.eventLoop {
+		return nil, mdgoErr.ErrNotSameLoop
+	}
+	if !conn.connected.Get() || !other.connected.Get() {
+		return nil, mdgoErr.ErrConnectionClosed
+	}
+
+	p := &Pipe{conn: conn, other: other}
+	if err := p.out.init(conn, other); err != nil {
+		return nil, err
+	}
+	if err := p.in.init(other, conn); err != nil {
+		p.out.closeFds()
+		return nil, err
+	}
+
+	if conn.eventLoop.IsInLoop() {
+		if err := p.start(); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+	conn.eventLoop.QueueInLoop(func() {
+		if err := p.start(); err != nil {
+			conn.eventLoop.logger.Warnf("pipe fd %d <-> fd %d: start err: %v", conn.Fd(), other.Fd(), err)
+		}
+	})
+	return p, nil
+}
+
+// conn -> other 已转发的字节数, 可以在任意协程中调用
+func (p *Pipe) BytesOut() int64 {
+	return p.out.bytes.Get()
+}
+
+// other -> conn 已转发的字节数, 可以在任意协程中调用
+func (p *Pipe) BytesIn() int64 {
+	return p.in.bytes.Get()
+}
+
+// 开始转发, 在事件循环中执行
+// 完成式 I/O 下 splice 需要就绪通知, 取消未完成的读, 等两端没有未完成的请求后转为就绪通知再开始
+func (p *Pipe) start() error {
+	conn, other := p.conn, p.other
+	if conn.pipe != nil || other.pipe != nil || conn.pipeWait != nil || other.pipeWait != nil {
+		p.out.closeFds()
+		p.in.closeFds()
+		return mdgoErr.ErrConnectionPiped
+	}
+
+	if conn.completion || other.completion {
+		conn.pipeWait, other.pipeWait = p, p
+		conn.cancelRecv()
+		other.cancelRecv()
+		p.tryStart()
+		return nil
+	}
+	return p.run()
+}
+
+// 两端都没有未完成的请求时转为就绪通知并开始转发
+func (p *Pipe) tryStart() {
+	conn, other := p.conn, p.other
+	if conn.recving || conn.sending || other.recving || other.sending {
+		return
+	}
+	conn.pipeWait, other.pipeWait = nil, nil
+	for _, c := range [...]*Connection{conn, other} {
+		if err := c.toReadiness(); err != nil {
+			conn.eventLoop.logger.Errorf("pipe fd %d: delete from poller err: %v", c.Fd(), err)
+		}
+	}
+	if err := p.run(); err != nil {
+		conn.eventLoop.logger.Warnf("pipe fd %d <-> fd %d: start err: %v", conn.Fd(), other.Fd(), err)
+	}
+}
+
+// 对接两端并开始转发
+func (p *Pipe) run() error {
+	conn, other := p.conn, p.other
+
+	// InBuf 中的数据先进入对端的输出缓冲, flush 时排在管道数据之前发出
+	p.out.forward()
+	p.in.forward()
+
+	// 投递期间或转发 InBuf 时任一端已关闭
+	if !conn.connected.Get() || !other.connected.Get() {
+		p.out.closeFds()
+		p.in.closeFds()
+		_ = conn.handleClose()
+		_ = other.handleClose()
+		return mdgoErr.ErrConnectionClosed
+	}
+
+	conn.pipe, other.pipe = p, p
+	p.pump(&p.out)
+	if !p.closed {
+		p.pump(&p.in)
+	}
+	return nil
+}
+
+// 连接 c 上的就绪事件, 在事件循环中执行
+// c 可写时推进写往 c 的方向, 可读时推进从 c 读的方向
+func (p *Pipe) handleEvent(c *Connection, eve event.Event) {
+	if eve&event.EventError != 0 {
+		_ = c.handleError(c.Fd())
+		_ = c.handleClose()
+		return
+	}
+
+	from, to := &p.out, &p.in
+	if c != p.conn {
+		from, to = &p.in, &p.out
+	}
+	if eve&event.EventWrite != 0 {
+		p.pump(to)
+	}
+	if eve&event.EventRead != 0 && !p.closed {
+		p.pump(from)
+	}
+}
+
+// 推进一个方向的转发, 然后更新两端关注的事件
+func (p *Pipe) pump(h *pipeHalf) {
+	if err := h.transfer(); err != nil {
+		p.conn.eventLoop.logger.Debugf("pipe fd %d -> fd %d: %v", h.src.Fd(), h.dst.Fd(), err)
+		_ = p.conn.handleClose()
+		return
+	}
+	if p.out.shut && p.in.shut {
+		_ = p.conn.handleClose()
+		return
+	}
+
+	p.updateEvents()
+}
+
+// 边缘触发下 c 恢复读取, 读出暂停期间到达的数据
+func (p *Pipe) resume(c *Connection) {
+	if c == p.conn {
+		p.pump(&p.out)
+	} else {
+		p.pump(&p.in)
+	}
+}
+
+// 按两个方向的状态更新两端关注的事件
+// 管道中有数据时不再读, 等待 dst 可写, 形成背压
+func (p *Pipe) updateEvents() {
+	if err := p.conn.setEvents(p.out.srcEvents() | p.in.dstEvents()); err != nil {
+		p.conn.eventLoop.logger.Errorf("pipe fd %d: update events err: %v", p.conn.Fd(), err)
+	}
+	if err := p.other.setEvents(p.in.srcEvents() | p.out.dstEvents()); err != nil {
+		p.conn.eventLoop.logger.Errorf("pipe fd %d: update events err: %v", p.other.Fd(), err)
+	}
+}
+
+// 一端关闭时调用, 释放内核管道并关闭另一端
+func (p *Pipe) close(c *Connection) {
+	if p.closed {
+		return
+	}
+	p.closed = true
+	p.conn.pipe, p.other.pipe = nil, nil
+	p.conn.pipeWait, p.other.pipeWait = nil, nil
+	p.out.closeFds()
+	p.in.closeFds()
+
+	if c == p.conn {
+		_ = p.other.handleClose()
+	} else {
+		_ = p.conn.handleClose()
+	}
+}
+
+func (h *pipeHalf) init(src, dst *Connection) error {
+	h.src, h.dst = src, dst
+	return syscall.Pipe2(h.fds[:], syscall.O_NONBLOCK|syscall.O_CLOEXEC)
+}
+
+func (h *pipeHalf) closeFds() {
+	_ = syscall.Close(h.fds[0])
+	_ = syscall.Close(h.fds[1])
+}
+
+// 把 src.InBuf 中的数据交给 dst 发送
+func (h *pipeHalf) forward() {
+	if !h.src.connected.Get() || !h.dst.connected.Get() {
+		return
+	}
+	if n := h.src.InBuf.ReadableBytes(); n > 0 {
+		_ = h.dst.writeInLoop(h.src.InBuf.PeekAll(), false, nil)
+		h.src.InBuf.RetrieveAll()
+		h.bytes.Add(int64(n))
+	}
+}
+
+// dst 还有数据未写出
+func (h *pipeHalf) blocked() bool {
+	return h.pending > 0 || h.dst.OutBuf.ReadableBytes() > 0
+}
+
+func (h *pipeHalf) srcEvents() event.Event {
+	if h.eof || h.blocked() {
+		return event.EventNone
+	}
+	return event.EventRead
+}
+
+func (h *pipeHalf) dstEvents() event.Event {
+	if h.blocked() {
+		return event.EventWrite
+	}
+	return event.EventNone
+}
+
+// 写出积压的数据, 没有积压时从 src 读一次并立即写出; 读到 EOF 且写完后 shutdown dst 的写
+// 水平触发下每次最多读 pipeSize 字节, 剩余数据会再次通知, 避免一条连接长时间占用事件循环;
+// 边缘触发下读到 EAGAIN 或 dst 写满为止
+func (h *pipeHalf) transfer() error {
+	if err := h.flush(); err != nil || h.blocked() {
+		return err
+	}
+
+	for !h.eof && !h.src.readPaused {
+		n, rerr := syscall.Splice(h.src.Fd(), nil, h.fds[1], nil, pipeSize, spliceFlags)
+		switch {
+		case rerr == syscall.EAGAIN: // 管道为空, 说明 src 暂无数据
+		case rerr != nil:
+			return rerr
+		case n == 0:
+			h.eof = true
+		default:
+			h.pending += int(n)
+		}
+		if err := h.flush(); err != nil || h.blocked() {
+			return err
+		}
+		if rerr == syscall.EAGAIN || !h.src.edgeTriggered {
+			break
+		}
+	}
+
+	if h.eof && !h.shut {
+		h.shut = true
+		return syscall.Shutdown(h.dst.Fd(), syscall.SHUT_WR)
+	}
+	return nil
+}
+
+// 先写出 dst 输出缓冲中对接前的数据, 再把管道中的数据写入 dst, 直到写完或 EAGAIN
+func (h *pipeHalf) flush() error {
+	dst := h.dst
+	if dst.OutBuf.ReadableBytes() > 0 {
+		_, errno := dst.OutBuf.WriteFd(dst.Fd(), dst.eventLoop.iovecs)
+		if errno != 0 && errno != syscall.EAGAIN {
+			return errno
+		}
+		if dst.OutBuf.ReadableBytes() > 0 {
+			return nil
+		}
+	}
+
+	for h.pending > 0 {
+		n, err := syscall.Splice(h.fds[0], nil, dst.Fd(), nil, h.pending, spliceFlags)
+		if err == syscall.EAGAIN {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		h.pending -= int(n)
+		h.bytes.Add(n)
+	}
+	return nil
+}
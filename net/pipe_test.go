@@ -0,0 +1,179 @@
+package net
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+// 启动转发服务器: 每个入站连接在同一事件循环上连接 backend, 连接建立后对接
+func startPipeServer(t *testing.T, backend string, mode ioMode) (*testServer, chan *Pipe, chan struct{}) {
+	pipeCh := make(chan *Pipe, 1)
+	closed := make(chan struct{}, 2)
+	serv := startTestServer(t, &testHandler{
+		onConnection: func(conn *Connection) {
+			cli, err := NewClient(conn.Loop(), &testHandler{
+				onConnection: func(bc *Connection) {
+					p, err := conn.Pipe(bc)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					pipeCh <- p
+				},
+				onClose: func() { closed <- struct{}{} },
+			}, append(mode.options(), Addr(backend))...)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			cli.Connect()
+		},
+		// 对接之前收到的数据留在 InBuf 中
+		onMessage: func(conn *Connection, nowUnix int64) {},
+		onClose:   func() { closed <- struct{}{} },
+	}, mode.options()...)
+	return serv, pipeCh, closed
+}
+
+func TestConnectionPipe(t *testing.T) {
+	for _, mode := range ioModes {
+		t.Run(mode.name, func(t *testing.T) {
+			testConnectionPipe(t, mode)
+		})
+	}
+}
+
+func testConnectionPipe(t *testing.T, mode ioMode) {
+	// 后端: 原样返回, 读到 EOF 后关闭写
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		_, _ = io.Copy(c, c)
+		_ = c.(*net.TCPConn).CloseWrite()
+	}()
+
+	serv, pipeCh, closed := startPipeServer(t, ln.Addr().String(), mode)
+	cli, err := net.Dial("tcp", serv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	payload := bytes.Repeat([]byte("mdgo splice pipe"), 512*1024) // 8MB
+	go func() {
+		_, _ = cli.Write(payload)
+		_ = cli.(*net.TCPConn).CloseWrite()
+	}()
+
+	_ = cli.SetReadDeadline(time.Now().Add(10 * time.Second))
+	got, err := ioutil.ReadAll(cli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Fatalf("got %d bytes, want %d", len(got), len(payload))
+	}
+
+	// 两个方向都结束后, 两端连接都被关闭
+	for i := 0; i < 2; i++ {
+		select {
+		case <-closed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("piped connections are not closed")
+		}
+	}
+	p := <-pipeCh
+	if p.BytesOut() != int64(len(payload)) || p.BytesIn() != int64(len(payload)) {
+		t.Fatalf("bytes out %d, in %d, want %d", p.BytesOut(), p.BytesIn(), len(payload))
+	}
+}
+
+func TestConnectionPipeHalfClose(t *testing.T) {
+	for _, mode := range ioModes {
+		t.Run(mode.name, func(t *testing.T) {
+			testConnectionPipeHalfClose(t, mode)
+		})
+	}
+}
+
+func testConnectionPipeHalfClose(t *testing.T, mode ioMode) {
+	// 后端: 先读到 EOF, 之后再回复
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		req, _ := ioutil.ReadAll(c)
+		_, _ = c.Write(append([]byte("reply to "), req...))
+	}()
+
+	serv, pipeCh, _ := startPipeServer(t, ln.Addr().String(), mode)
+	cli, err := net.Dial("tcp", serv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	if _, err = cli.Write([]byte("request")); err != nil {
+		t.Fatal(err)
+	}
+	// 对接之前读到 EOF 时连接直接关闭, 对接后再关闭写
+	select {
+	case <-pipeCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait pipe timeout")
+	}
+	_ = cli.(*net.TCPConn).CloseWrite()
+
+	_ = cli.SetReadDeadline(time.Now().Add(5 * time.Second))
+	got, err := ioutil.ReadAll(cli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "reply to request" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestConnectionPipeNotSameLoop(t *testing.T) {
+	connCh := make(chan *Connection, 2)
+	serv := startTestServer(t, &testHandler{
+		onConnection: func(conn *Connection) { connCh <- conn },
+	})
+	loop, err := NewEventLoop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loop.Stop()
+
+	cli, err := net.Dial("tcp", serv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	conn := <-connCh
+
+	other := &Connection{eventLoop: loop}
+	other.connected.Set(true)
+	if _, err = conn.Pipe(other); err == nil {
+		t.Fatal("Pipe between loops succeeds")
+	}
+}
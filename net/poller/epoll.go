@@ -3,13 +3,13 @@
 package poller
 
 import (
-	"fmt"
 	"syscall"
 	"time"
 
 	"github.com/aizsfgk/mdgo/base/atomic"
 	mdgoErr "github.com/aizsfgk/mdgo/net/errors"
 	"github.com/aizsfgk/mdgo/net/event"
+	"github.com/aizsfgk/mdgo/net/logger"
 )
 
 const (
@@ -44,37 +44,40 @@ const (
 	readEvent  = syscall.EPOLLIN | syscall.EPOLLPRI | syscall.EPOLLRDHUP
 	writeEvent = syscall.EPOLLOUT | syscall.EPOLLHUP
 	errorEvent = syscall.EPOLLERR // 发生了真实的错误
+	edgeEvent  = 1 << 31          // EPOLLET, syscall 中定义为负数
 )
 
-type Poller struct {
+type epoll struct {
 	running atomic.Bool
 	epFd    int
 	events  []syscall.EpollEvent
+	logger  logger.Logger
 }
 
 // 创建
-func Create() (*Poller, error) {
+func newEpoll(l logger.Logger) (*epoll, error) {
 	epFd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC) // 为何要使用这些标志
 	if err != nil {
-		fmt.Println("Create-err: ", err)
+		l.Errorf("epoll_create1 err: %v", err)
 		_ = syscall.Close(epFd)
 		return nil, err
 	}
-	fmt.Println("*** new epollFd: ", epFd, "***")
-	return &Poller{
+	l.Debugf("new epoll fd: %d", epFd)
+	return &epoll{
 		epFd:   epFd,
 		events: make([]syscall.EpollEvent, WaitEventsBegin),
+		logger: l,
 	}, nil
 }
 
-func (p *Poller) Close() error {
+func (p *epoll) Close() error {
 	_ = syscall.Close(p.epFd)
 	return nil
 }
 
 // ***************** 操作 - 私有方法 ***************** //
 // 增加事件
-func (p *Poller) add(fd int, events uint32) error {
+func (p *epoll) add(fd int, events uint32) error {
 	return syscall.EpollCtl(p.epFd, syscall.EPOLL_CTL_ADD, fd, &syscall.EpollEvent{
 		Events: events,
 		Fd:     int32(fd),
@@ -82,7 +85,7 @@ func (p *Poller) add(fd int, events uint32) error {
 }
 
 // 修改事件
-func (p *Poller) mod(fd int, events uint32) error {
+func (p *epoll) mod(fd int, events uint32) error {
 	return syscall.EpollCtl(p.epFd, syscall.EPOLL_CTL_MOD, fd, &syscall.EpollEvent{
 		Events: events,
 		Fd:     int32(fd),
@@ -90,17 +93,15 @@ func (p *Poller) mod(fd int, events uint32) error {
 }
 
 // 删除事件
-func (p *Poller) Del(fd int) error {
+func (p *epoll) Del(fd int) error {
 	return syscall.EpollCtl(p.epFd, syscall.EPOLL_CTL_DEL, fd, nil)
 }
 
-func (p *Poller) Add(fd int, eve event.Event) error {
+func (p *epoll) Add(fd int, eve event.Event) error {
 	var events uint32
 
 	if eve&event.EventRead != 0 {
 		events |= readEvent
-		fmt.Println("add readEvent")
-		fmt.Println("events:", events)
 		return p.add(fd, events)
 	}
 
@@ -112,16 +113,21 @@ func (p *Poller) Add(fd int, eve event.Event) error {
 	return mdgoErr.EventIsNil
 }
 
+// 以边缘触发方式同时关注读写事件, 之后无需再修改
+func (p *epoll) AddEdgeTriggered(fd int) error {
+	return p.add(fd, readEvent|writeEvent|edgeEvent)
+}
+
 // **************** 激活 - 共有 ***************** //
-func (p *Poller) EnableRead(fd int) error {
+func (p *epoll) EnableRead(fd int) error {
 	return p.mod(fd, readEvent)
 }
 
-func (p *Poller) EnableWrite(fd int) error {
+func (p *epoll) EnableWrite(fd int) error {
 	return p.mod(fd, writeEvent)
 }
 
-func (p *Poller) EnableReadWrite(fd int) error {
+func (p *epoll) EnableReadWrite(fd int) error {
 	return p.mod(fd, readEvent|writeEvent)
 }
 
@@ -129,7 +135,7 @@ func (p *Poller) EnableReadWrite(fd int) error {
 	就绪事件如何暴露出来???这是一个值得思考的问题
 
 */
-func (p *Poller) Poll(msec int, acp *[]event.EventHolder) (int64, int) {
+func (p *epoll) Poll(msec int, acp *[]event.EventHolder) (int64, int) {
 
 	n, err := syscall.EpollWait(p.epFd, p.events, msec) // 事件就绪
 	nowUnix := time.Now().Unix()
@@ -141,10 +147,14 @@ func (p *Poller) Poll(msec int, acp *[]event.EventHolder) (int64, int) {
 			return nowUnix, 0
 		}
 
-		fmt.Println("++++ epollWait Err: ", err.Error(), " +++")
+		p.logger.Errorf("epoll fd %d: epoll_wait err: %v", p.epFd, err)
 		return nowUnix, 0
 	}
 
+	if len(*acp) < n {
+		*acp = make([]event.EventHolder, len(p.events))
+	}
+
 	var evHolder event.EventHolder
 	for i := 0; i < n; i++ {
 		retEvent := event.EventNone
@@ -164,7 +174,7 @@ func (p *Poller) Poll(msec int, acp *[]event.EventHolder) (int64, int) {
 	}
 
 	if len(p.events) == n {
-		p.events = make([]syscall.EpollEvent, 2*WaitEventsBegin)
+		p.events = make([]syscall.EpollEvent, 2*len(p.events))
 	}
 
 	return nowUnix, n
@@ -0,0 +1,812 @@
+package poller
+
+import (
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	mdgoErr "github.com/aizsfgk/mdgo/net/errors"
+	"github.com/aizsfgk/mdgo/net/event"
+	"github.com/aizsfgk/mdgo/net/logger"
+)
+
+/*
+	io_uring 轮询器, 同时支持完成式 I/O 与就绪通知
+
+	完成式 I/O(CompletionPoller): 连接的读写及监听套接字的 accept 作为请求提交, 完成后由 Poll 返回:
+	1. 读使用轮询器提供的缓冲(IORING_OP_PROVIDE_BUFFERS), 数据到达时才占用缓冲, 空闲连接不占内存;
+	   缓冲在下一次 Poll 时归还内核, 缓冲用尽(ENOBUFS)时归还后重新提交
+	2. 写通过 IORING_OP_SENDMSG 提交, 完成前轮询器持有 msghdr, 其引用的数据不会被回收
+	3. Del 立即提交取消请求, 之后调用者关闭 fd 也不会影响复用该 fd 的新连接;
+	   Close 取消全部请求并等待完成, 之后内核不再访问读缓冲及待发送的数据
+
+	就绪通知(Poller): eventfd、timerfd 及正在连接的套接字等仍使用就绪通知,
+	通过 IORING_OP_POLL_ADD 实现, 语义与 epoll 水平触发一致:
+	1. poll 请求是一次性的, 完成后在下一次 Poll 时按当前关注的事件重新提交,
+	   提交时若仍然就绪会立即完成, 因此未处理完的事件会再次通知
+	2. Add/Enable* 只是把 SQE 放入提交队列, 与等待一起由一次 io_uring_enter 提交, 省去 epoll_ctl
+	3. 等待超时通过 IORING_OP_TIMEOUT 实现, count 为 1, 有其他完成事件时随之结束
+
+	user_data 低 32 位为 fd, 其上 8 位为操作类型, 高 24 位为序号, 用于识别已删除或已取消的请求
+*/
+
+const (
+	sysIOUringSetup = 425
+	sysIOUringEnter = 426
+
+	ioringOffSqRing = 0
+	ioringOffCqRing = 0x8000000
+	ioringOffSqes   = 0x10000000
+
+	ioringFeatSingleMmap = 1 << 0
+	ioringFeatNoDrop     = 1 << 1 // since 5.5, 完成队列满时不丢弃
+	ioringFeatFastPoll   = 1 << 5 // since 5.7, 同时有 RECV/ACCEPT/PROVIDE_BUFFERS
+
+	ioringEnterGetEvents = 1 << 0
+
+	ioringOpPollAdd        = 6
+	ioringOpPollRemove     = 7
+	ioringOpSendmsg        = 9
+	ioringOpTimeout        = 11
+	ioringOpAccept         = 13
+	ioringOpAsyncCancel    = 14
+	ioringOpRecv           = 27
+	ioringOpProvideBuffers = 31
+
+	iosqeBufferSelect    = 1 << 5
+	ioringCqeFBuffer     = 1 << 0
+	ioringCqeBufferShift = 16
+
+	uringEntries = 1024
+	ignoreData   = ^uint64(0) // 超时、取消及归还缓冲请求的 user_data, 其完成事件直接忽略
+	genMask      = 1<<24 - 1
+
+	recvBufGroup = 1
+	recvBufCount = 128
+	recvBufSize  = 16 * 1024
+)
+
+// user_data 中的操作类型
+const (
+	uopPoll = iota + 1 // 就绪通知
+	uopRecv            // 以下为完成式 I/O
+	uopSend
+	uopAccept
+	uopWritable
+)
+
+var uopToOp = [...]event.Op{
+	uopRecv:     event.OpRecv,
+	uopSend:     event.OpSend,
+	uopAccept:   event.OpAccept,
+	uopWritable: event.OpWritable,
+}
+
+// struct io_uring_params
+type uringParams struct {
+	sqEntries    uint32
+	cqEntries    uint32
+	flags        uint32
+	sqThreadCPU  uint32
+	sqThreadIdle uint32
+	features     uint32
+	wqFd         uint32
+	resv         [3]uint32
+	sqOff        sqRingOffsets
+	cqOff        cqRingOffsets
+}
+
+type sqRingOffsets struct {
+	head        uint32
+	tail        uint32
+	ringMask    uint32
+	ringEntries uint32
+	flags       uint32
+	dropped     uint32
+	array       uint32
+	resv1       uint32
+	userAddr    uint64
+}
+
+type cqRingOffsets struct {
+	head        uint32
+	tail        uint32
+	ringMask    uint32
+	ringEntries uint32
+	overflow    uint32
+	cqes        uint32
+	flags       uint32
+	resv1       uint32
+	userAddr    uint64
+}
+
+// struct io_uring_sqe
+type uringSqe struct {
+	opcode      uint8
+	flags       uint8
+	ioprio      uint16
+	fd          int32
+	off         uint64
+	addr        uint64
+	len         uint32
+	opFlags     uint32 // poll32_events / timeout_flags
+	userData    uint64
+	bufIndex    uint16
+	personality uint16
+	spliceFdIn  int32
+	addr3       uint64
+	pad         uint64
+}
+
+// struct __kernel_timespec, 32 位平台上与 syscall.Timespec 不同
+type kernelTimespec struct {
+	sec  int64
+	nsec int64
+}
+
+// struct io_uring_cqe
+type uringCqe struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// 注册的 fd
+type uringFd struct {
+	events     uint32          // 就绪通知: 关注的事件, 与 epoll 相同的位
+	gen        uint32          // 就绪通知: 当前 poll 请求的序号; 完成式: 注册的序号
+	armed      bool            // 就绪通知: 已提交 poll 请求, 尚未完成
+	completion bool            // 完成式 I/O
+	inflight   uint8           // 完成式: 未完成的操作, 1 << uop
+	starved    bool            // 完成式: Recv 因缓冲用尽待重新提交
+	canceled   bool            // 完成式: 待重新提交的 Recv 已被取消
+	msg        *syscall.Msghdr // 完成式: 未完成的 sendmsg
+}
+
+type uring struct {
+	ringFd int
+	sqRing []byte
+	cqRing []byte
+	sqeMem []byte
+
+	sqHead  *uint32
+	sqTail  *uint32
+	sqMask  uint32
+	sqSize  uint32
+	sqArray []uint32
+	sqes    []uringSqe
+	tail    uint32 // 本地的提交队列尾, 提交前写回 sqTail
+	pending uint32 // 尚未提交的 SQE 数
+
+	cqHead *uint32
+	cqTail *uint32
+	cqMask uint32
+	cqes   []uringCqe
+
+	fds    map[int]uringFd // fd -> 状态
+	rearm  []int           // poll 请求已完成, 需重新提交的 fd
+	gen    uint32          // 序号
+	ts     kernelTimespec  // 超时, IORING_OP_TIMEOUT 提交时由内核拷贝
+	logger logger.Logger
+
+	bufs     []byte                     // 读缓冲, recvBufCount 块, 每块 recvBufSize
+	used     []uint16                   // 本轮被占用的缓冲, 下一次 Poll 时归还
+	starved  []int                      // Recv 因缓冲用尽失败的 fd
+	inflight int                        // 未完成的读写及 accept 请求数, 关闭前需等待完成
+	orphans  map[uint64]*syscall.Msghdr // 已删除的 fd 上未完成的 sendmsg
+}
+
+func newIOUring(l logger.Logger) (*uring, error) {
+	var params uringParams
+	fd, _, errno := syscall.Syscall(sysIOUringSetup, uringEntries, uintptr(unsafe.Pointer(&params)), 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	r := &uring{
+		ringFd:  int(fd),
+		fds:     make(map[int]uringFd, WaitEventsBegin),
+		logger:  l,
+		bufs:    make([]byte, recvBufCount*recvBufSize),
+		used:    make([]uint16, 0, recvBufCount),
+		orphans: make(map[uint64]*syscall.Msghdr),
+	}
+	// 需要 IORING_FEAT_NODROP, 否则完成事件可能丢失; IORING_FEAT_FAST_POLL 表示支持完成式 I/O 所需的操作
+	if params.features&ioringFeatNoDrop == 0 || params.features&ioringFeatFastPoll == 0 {
+		_ = r.Close()
+		return nil, syscall.ENOSYS
+	}
+	if err := r.mmap(&params); err != nil {
+		_ = r.Close()
+		return nil, err
+	}
+	if err := r.provideBuffers(); err != nil {
+		_ = r.Close()
+		return nil, err
+	}
+	l.Debugf("new io_uring fd: %d, entries: %d", r.ringFd, params.sqEntries)
+	return r, nil
+}
+
+// 提供全部读缓冲并等待完成, 内核不支持时返回错误
+func (r *uring) provideBuffers() error {
+	sqe := r.getSqe()
+	sqe.opcode = ioringOpProvideBuffers
+	sqe.fd = recvBufCount
+	sqe.addr = uint64(uintptr(unsafe.Pointer(&r.bufs[0])))
+	sqe.len = recvBufSize
+	sqe.bufIndex = recvBufGroup
+	sqe.userData = ignoreData
+	if err := r.submit(1, ioringEnterGetEvents); err != nil {
+		return err
+	}
+	head := *r.cqHead
+	cqe := r.cqes[head&r.cqMask]
+	atomic.StoreUint32(r.cqHead, head+1)
+	if cqe.res < 0 {
+		return syscall.Errno(-cqe.res)
+	}
+	return nil
+}
+
+// 归还一块读缓冲
+func (r *uring) provideBuffer(bid uint16) {
+	sqe := r.getSqe()
+	sqe.opcode = ioringOpProvideBuffers
+	sqe.fd = 1
+	sqe.addr = uint64(uintptr(unsafe.Pointer(&r.bufs[int(bid)*recvBufSize])))
+	sqe.len = recvBufSize
+	sqe.off = uint64(bid)
+	sqe.bufIndex = recvBufGroup
+	sqe.userData = ignoreData
+}
+
+func (r *uring) mmap(p *uringParams) error {
+	var err error
+	sqSize := int(p.sqOff.array + p.sqEntries*4)
+	cqSize := int(p.cqOff.cqes + p.cqEntries*uint32(unsafe.Sizeof(uringCqe{})))
+	if p.features&ioringFeatSingleMmap != 0 && cqSize > sqSize {
+		sqSize = cqSize
+	}
+
+	r.sqRing, err = syscall.Mmap(r.ringFd, ioringOffSqRing, sqSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_POPULATE)
+	if err != nil {
+		return err
+	}
+	if p.features&ioringFeatSingleMmap != 0 {
+		r.cqRing = r.sqRing
+	} else {
+		r.cqRing, err = syscall.Mmap(r.ringFd, ioringOffCqRing, cqSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_POPULATE)
+		if err != nil {
+			return err
+		}
+	}
+	r.sqeMem, err = syscall.Mmap(r.ringFd, ioringOffSqes, int(p.sqEntries)*int(unsafe.Sizeof(uringSqe{})), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_POPULATE)
+	if err != nil {
+		return err
+	}
+
+	r.sqHead = (*uint32)(unsafe.Pointer(&r.sqRing[p.sqOff.head]))
+	r.sqTail = (*uint32)(unsafe.Pointer(&r.sqRing[p.sqOff.tail]))
+	r.sqMask = *(*uint32)(unsafe.Pointer(&r.sqRing[p.sqOff.ringMask]))
+	r.sqSize = p.sqEntries
+	r.sqArray = (*[1 << 20]uint32)(unsafe.Pointer(&r.sqRing[p.sqOff.array]))[:p.sqEntries:p.sqEntries]
+	r.sqes = (*[1 << 20]uringSqe)(unsafe.Pointer(&r.sqeMem[0]))[:p.sqEntries:p.sqEntries]
+	r.tail = atomic.LoadUint32(r.sqTail)
+
+	r.cqHead = (*uint32)(unsafe.Pointer(&r.cqRing[p.cqOff.head]))
+	r.cqTail = (*uint32)(unsafe.Pointer(&r.cqRing[p.cqOff.tail]))
+	r.cqMask = *(*uint32)(unsafe.Pointer(&r.cqRing[p.cqOff.ringMask]))
+	r.cqes = (*[1 << 20]uringCqe)(unsafe.Pointer(&r.cqRing[p.cqOff.cqes]))[:p.cqEntries:p.cqEntries]
+	return nil
+}
+
+// 取消所有未完成的请求并等待读写请求完成, 再释放 ring
+func (r *uring) Close() error {
+	if r.sqeMem != nil {
+		r.drain()
+	}
+	if r.sqeMem != nil {
+		_ = syscall.Munmap(r.sqeMem)
+	}
+	if r.cqRing != nil && &r.cqRing[0] != &r.sqRing[0] {
+		_ = syscall.Munmap(r.cqRing)
+	}
+	if r.sqRing != nil {
+		_ = syscall.Munmap(r.sqRing)
+	}
+	r.sqRing, r.cqRing, r.sqeMem = nil, nil, nil
+	return syscall.Close(r.ringFd)
+}
+
+func (r *uring) enter(toSubmit, minComplete, flags uint32) (int, error) {
+	n, _, errno := syscall.Syscall6(sysIOUringEnter, uintptr(r.ringFd), uintptr(toSubmit), uintptr(minComplete), uintptr(flags), 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(n), nil
+}
+
+// 提交队列中的 SQE, 不等待完成
+func (r *uring) submit(minComplete, flags uint32) error {
+	atomic.StoreUint32(r.sqTail, r.tail)
+	n, err := r.enter(r.pending, minComplete, flags)
+	r.pending -= uint32(n)
+	return err
+}
+
+// 取一个空闲的 SQE, 提交队列满时先提交
+func (r *uring) getSqe() *uringSqe {
+	for r.tail-atomic.LoadUint32(r.sqHead) >= r.sqSize {
+		if err := r.submit(0, 0); err != nil && err != syscall.EINTR && err != syscall.EAGAIN && err != syscall.EBUSY {
+			r.logger.Errorf("io_uring fd %d: submit err: %v", r.ringFd, err)
+		}
+	}
+	idx := r.tail & r.sqMask
+	sqe := &r.sqes[idx]
+	*sqe = uringSqe{}
+	r.sqArray[idx] = idx
+	r.tail++
+	r.pending++
+	return sqe
+}
+
+func userData(fd int, uop uint8, gen uint32) uint64 {
+	return uint64(uint32(fd)) | uint64(uop)<<32 | uint64(gen&genMask)<<40
+}
+
+func parseUserData(data uint64) (fd int, uop uint8, gen uint32) {
+	return int(int32(uint32(data))), uint8(data >> 32), uint32(data >> 40)
+}
+
+func (r *uring) nextGen() uint32 {
+	r.gen = (r.gen + 1) & genMask
+	return r.gen
+}
+
+// 按 st.events 提交 poll 请求
+func (r *uring) arm(fd int, st *uringFd) {
+	st.gen = r.nextGen()
+	st.armed = true
+
+	sqe := r.getSqe()
+	sqe.opcode = ioringOpPollAdd
+	sqe.fd = int32(fd)
+	sqe.opFlags = st.events
+	sqe.userData = userData(fd, uopPoll, st.gen)
+}
+
+// 取消 user_data 为 target 的请求
+func (r *uring) cancelData(target uint64) {
+	sqe := r.getSqe()
+	sqe.opcode = ioringOpAsyncCancel
+	sqe.fd = -1
+	sqe.addr = target
+	sqe.userData = ignoreData
+}
+
+// 取消未完成的 poll 请求
+func (r *uring) cancel(fd int, st *uringFd) {
+	if !st.armed {
+		return
+	}
+	st.armed = false
+
+	sqe := r.getSqe()
+	sqe.opcode = ioringOpPollRemove
+	sqe.fd = -1
+	sqe.addr = userData(fd, uopPoll, st.gen)
+	sqe.userData = ignoreData
+}
+
+// 取消 fd 上未完成的完成式请求
+func (r *uring) cancelAll(fd int, st *uringFd) {
+	for uop := uint8(uopRecv); uop <= uopWritable; uop++ {
+		if st.inflight&(1<<uop) == 0 {
+			continue
+		}
+		if uop == uopRecv && st.starved {
+			continue
+		}
+		r.cancelData(userData(fd, uop, st.gen))
+	}
+}
+
+func (r *uring) Add(fd int, eve event.Event) error {
+	var events uint32
+
+	if eve&event.EventRead != 0 {
+		events = readEvent
+	} else if eve&event.EventWrite != 0 {
+		events = writeEvent
+	} else {
+		return mdgoErr.EventIsNil
+	}
+
+	if _, ok := r.fds[fd]; ok {
+		return syscall.EEXIST
+	}
+	st := uringFd{events: events}
+	r.arm(fd, &st)
+	r.fds[fd] = st
+	return nil
+}
+
+// 立即提交取消请求及队列中该 fd 的请求, 之后关闭 fd 才会真正释放套接字,
+// 队列中的请求也不会作用于复用该 fd 的新套接字
+func (r *uring) Del(fd int) error {
+	st, ok := r.fds[fd]
+	if !ok {
+		return syscall.ENOENT
+	}
+	delete(r.fds, fd)
+	if st.completion {
+		r.cancelAll(fd, &st)
+		// 发送完成前保持数据可达
+		if st.msg != nil {
+			r.orphans[userData(fd, uopSend, st.gen)] = st.msg
+		}
+		return r.submit(0, 0)
+	}
+	if st.armed {
+		r.cancel(fd, &st)
+		return r.submit(0, 0)
+	}
+	return nil
+}
+
+func (r *uring) mod(fd int, events uint32) error {
+	st, ok := r.fds[fd]
+	if !ok || st.completion {
+		return syscall.ENOENT
+	}
+	if st.events == events {
+		return nil
+	}
+	st.events = events
+	// 未提交的在下一次 Poll 时按新的事件提交
+	if st.armed {
+		r.cancel(fd, &st)
+		r.arm(fd, &st)
+	}
+	r.fds[fd] = st
+	return nil
+}
+
+func (r *uring) EnableRead(fd int) error {
+	return r.mod(fd, readEvent)
+}
+
+func (r *uring) EnableWrite(fd int) error {
+	return r.mod(fd, writeEvent)
+}
+
+func (r *uring) EnableReadWrite(fd int) error {
+	return r.mod(fd, readEvent|writeEvent)
+}
+
+// ***************** 完成式 I/O ***************** //
+
+func (r *uring) AddCompletion(fd int) error {
+	if _, ok := r.fds[fd]; ok {
+		return syscall.EEXIST
+	}
+	r.fds[fd] = uringFd{completion: true, gen: r.nextGen()}
+	return nil
+}
+
+// 取得 fd 的状态, 并检查 uop 没有未完成的请求
+func (r *uring) completionFd(fd int, uop uint8) (uringFd, error) {
+	st, ok := r.fds[fd]
+	if !ok || !st.completion {
+		return st, syscall.ENOENT
+	}
+	if st.inflight&(1<<uop) != 0 {
+		return st, syscall.EALREADY
+	}
+	return st, nil
+}
+
+func (r *uring) prep(fd int, st *uringFd, uop uint8) *uringSqe {
+	st.inflight |= 1 << uop
+	sqe := r.getSqe()
+	sqe.fd = int32(fd)
+	sqe.userData = userData(fd, uop, st.gen)
+	return sqe
+}
+
+func (r *uring) recv(fd int, st *uringFd) {
+	sqe := r.prep(fd, st, uopRecv)
+	sqe.opcode = ioringOpRecv
+	sqe.len = recvBufSize
+	sqe.flags = iosqeBufferSelect
+	sqe.bufIndex = recvBufGroup
+	r.inflight++
+}
+
+func (r *uring) Recv(fd int) error {
+	st, err := r.completionFd(fd, uopRecv)
+	if err != nil {
+		return err
+	}
+	r.recv(fd, &st)
+	r.fds[fd] = st
+	return nil
+}
+
+func (r *uring) CancelRecv(fd int) error {
+	st, ok := r.fds[fd]
+	if !ok || !st.completion || st.inflight&(1<<uopRecv) == 0 {
+		return syscall.ENOENT
+	}
+	if st.starved {
+		// 尚未重新提交, 下一次 Poll 时直接返回取消
+		st.canceled = true
+		r.fds[fd] = st
+		return nil
+	}
+	r.cancelData(userData(fd, uopRecv, st.gen))
+	return nil
+}
+
+func (r *uring) Sendmsg(fd int, msg *syscall.Msghdr) error {
+	st, err := r.completionFd(fd, uopSend)
+	if err != nil {
+		return err
+	}
+	sqe := r.prep(fd, &st, uopSend)
+	sqe.opcode = ioringOpSendmsg
+	sqe.addr = uint64(uintptr(unsafe.Pointer(msg)))
+	sqe.opFlags = syscall.MSG_NOSIGNAL
+	st.msg = msg
+	r.inflight++
+	r.fds[fd] = st
+	return nil
+}
+
+func (r *uring) WaitWritable(fd int) error {
+	st, err := r.completionFd(fd, uopWritable)
+	if err != nil {
+		return err
+	}
+	sqe := r.prep(fd, &st, uopWritable)
+	sqe.opcode = ioringOpPollAdd
+	sqe.opFlags = writeEvent
+	r.fds[fd] = st
+	return nil
+}
+
+func (r *uring) Accept(fd int) error {
+	st, err := r.completionFd(fd, uopAccept)
+	if err != nil {
+		return err
+	}
+	sqe := r.prep(fd, &st, uopAccept)
+	sqe.opcode = ioringOpAccept
+	sqe.opFlags = syscall.SOCK_NONBLOCK | syscall.SOCK_CLOEXEC
+	r.inflight++
+	r.fds[fd] = st
+	return nil
+}
+
+// 归还上一轮占用的读缓冲, 并重新提交因缓冲用尽失败的 Recv; 已取消的返回取消事件
+func (r *uring) replenish(acp *[]event.EventHolder) int {
+	for _, bid := range r.used {
+		r.provideBuffer(bid)
+	}
+	r.used = r.used[:0]
+
+	ready := 0
+	for _, fd := range r.starved {
+		st, ok := r.fds[fd]
+		if !ok || !st.starved {
+			continue
+		}
+		st.starved = false
+		if st.canceled {
+			st.canceled = false
+			st.inflight &^= 1 << uopRecv
+			ready = appendEvent(acp, ready, event.EventHolder{Fd: fd, Op: event.OpRecv, Res: -int(syscall.ECANCELED)})
+		} else {
+			r.recv(fd, &st)
+		}
+		r.fds[fd] = st
+	}
+	r.starved = r.starved[:0]
+	return ready
+}
+
+// 处理完成式请求的完成事件, 返回是否需要通知调用者
+func (r *uring) complete(cqe *uringCqe, ev *event.EventHolder) bool {
+	fd, uop, gen := parseUserData(cqe.userData)
+	if uop != uopWritable {
+		r.inflight--
+	}
+	if uop == uopSend {
+		delete(r.orphans, cqe.userData)
+	}
+	st, ok := r.fds[fd]
+	if !ok || !st.completion || st.gen != gen {
+		// fd 已删除, 取消前已接收的连接直接关闭
+		if uop == uopAccept && cqe.res >= 0 {
+			_ = syscall.Close(int(cqe.res))
+		}
+		return false
+	}
+
+	res := int(cqe.res)
+	if uop == uopRecv && res == -int(syscall.ENOBUFS) {
+		st.starved = true
+		r.fds[fd] = st
+		r.starved = append(r.starved, fd)
+		return false
+	}
+	st.inflight &^= 1 << uop
+	if uop == uopSend {
+		st.msg = nil
+	}
+	r.fds[fd] = st
+
+	*ev = event.EventHolder{Fd: fd, Op: uopToOp[uop], Res: res}
+	if uop == uopRecv && res > 0 && cqe.flags&ioringCqeFBuffer != 0 {
+		off := int(cqe.flags>>ioringCqeBufferShift) * recvBufSize
+		ev.Data = r.bufs[off : off+res]
+	}
+	return true
+}
+
+func appendEvent(acp *[]event.EventHolder, ready int, ev event.EventHolder) int {
+	if ready == len(*acp) {
+		grown := make([]event.EventHolder, 2*len(*acp)+1)
+		copy(grown, *acp)
+		*acp = grown
+	}
+	(*acp)[ready] = ev
+	return ready + 1
+}
+
+// 取消所有完成式请求, 等待读写及 accept 请求完成, 最多等待约 1 秒
+func (r *uring) drain() {
+	for fd, st := range r.fds {
+		if st.completion {
+			r.cancelAll(fd, &st)
+		}
+	}
+	for i := 0; r.inflight > 0 && i < 100; i++ {
+		r.prepTimeout(10 * time.Millisecond)
+		if err := r.submit(1, ioringEnterGetEvents); err != nil && err != syscall.EINTR && err != syscall.EAGAIN && err != syscall.EBUSY {
+			break
+		}
+		head := *r.cqHead
+		tail := atomic.LoadUint32(r.cqTail)
+		for ; head != tail; head++ {
+			cqe := &r.cqes[head&r.cqMask]
+			if cqe.userData == ignoreData {
+				continue
+			}
+			switch _, uop, _ := parseUserData(cqe.userData); uop {
+			case uopRecv, uopSend:
+				r.inflight--
+			case uopAccept:
+				// 取消前已接收的连接
+				r.inflight--
+				if cqe.res >= 0 {
+					_ = syscall.Close(int(cqe.res))
+				}
+			}
+		}
+		atomic.StoreUint32(r.cqHead, head)
+	}
+	if r.inflight > 0 {
+		r.logger.Errorf("io_uring fd %d: %d requests are not completed", r.ringFd, r.inflight)
+	}
+}
+
+// 提交超时请求, 有一个完成事件或超时后结束等待
+func (r *uring) prepTimeout(d time.Duration) {
+	r.ts = kernelTimespec{sec: int64(d / time.Second), nsec: int64(d % time.Second)}
+	sqe := r.getSqe()
+	sqe.opcode = ioringOpTimeout
+	sqe.fd = -1
+	sqe.addr = uint64(uintptr(unsafe.Pointer(&r.ts)))
+	sqe.len = 1
+	sqe.off = 1 // 任意一个完成事件到达即结束
+	sqe.userData = ignoreData
+}
+
+// 跳过队首不需要处理的完成事件
+func (r *uring) skipIgnored() {
+	head := *r.cqHead
+	for head != atomic.LoadUint32(r.cqTail) && r.cqes[head&r.cqMask].userData == ignoreData {
+		head++
+	}
+	atomic.StoreUint32(r.cqHead, head)
+}
+
+func (r *uring) Poll(msec int, acp *[]event.EventHolder) (int64, int) {
+	// 重新提交上一轮完成的 poll 请求
+	for _, fd := range r.rearm {
+		if st, ok := r.fds[fd]; ok && !st.completion && !st.armed {
+			r.arm(fd, &st)
+			r.fds[fd] = st
+		}
+	}
+	r.rearm = r.rearm[:0]
+	ready := r.replenish(acp)
+
+	var minComplete, flags uint32
+	if msec != 0 && ready == 0 {
+		// 归还缓冲、取消等请求先单独提交并跳过其完成事件, 否则会立即满足等待, 返回空的一轮
+		if r.pending > 0 {
+			if err := r.submit(0, 0); err != nil && err != syscall.EINTR && err != syscall.EAGAIN && err != syscall.EBUSY {
+				r.logger.Errorf("io_uring fd %d: submit err: %v", r.ringFd, err)
+			}
+			r.skipIgnored()
+		}
+		if atomic.LoadUint32(r.cqTail) == *r.cqHead {
+			minComplete, flags = 1, ioringEnterGetEvents
+			if msec > 0 {
+				r.prepTimeout(time.Duration(msec) * time.Millisecond)
+			}
+		}
+	}
+
+	err := r.submit(minComplete, flags)
+	nowUnix := time.Now().Unix()
+	if err != nil && err != syscall.EINTR && err != syscall.EAGAIN && err != syscall.EBUSY {
+		r.logger.Errorf("io_uring fd %d: io_uring_enter err: %v", r.ringFd, err)
+	}
+
+	head := *r.cqHead
+	tail := atomic.LoadUint32(r.cqTail)
+	for ; head != tail; head++ {
+		cqe := &r.cqes[head&r.cqMask]
+		if cqe.userData == ignoreData {
+			continue
+		}
+		// 占用的读缓冲无论是否通知调用者, 都在下一次 Poll 时归还
+		if cqe.flags&ioringCqeFBuffer != 0 {
+			r.used = append(r.used, uint16(cqe.flags>>ioringCqeBufferShift))
+		}
+		fd, uop, gen := parseUserData(cqe.userData)
+		if uop != uopPoll {
+			var ev event.EventHolder
+			if r.complete(cqe, &ev) {
+				ready = appendEvent(acp, ready, ev)
+			}
+			continue
+		}
+
+		st, ok := r.fds[fd]
+		if !ok || st.completion || !st.armed || st.gen != gen {
+			continue // 已删除或已取消的请求
+		}
+		st.armed = false
+		r.fds[fd] = st
+		r.rearm = append(r.rearm, fd)
+
+		retEvent := event.EventNone
+		if cqe.res < 0 {
+			if syscall.Errno(-cqe.res) == syscall.ECANCELED {
+				continue
+			}
+			r.logger.Warnf("io_uring fd %d: poll fd %d err: %v", r.ringFd, fd, syscall.Errno(-cqe.res))
+			retEvent = event.EventError
+		} else {
+			revents := uint32(cqe.res)
+			if revents&errorEvent != 0 {
+				retEvent |= event.EventError
+			}
+			if revents&readEvent != 0 {
+				retEvent |= event.EventRead
+			}
+			if revents&writeEvent != 0 {
+				retEvent |= event.EventWrite
+			}
+		}
+		ready = appendEvent(acp, ready, event.EventHolder{Fd: fd, Revent: retEvent})
+	}
+	atomic.StoreUint32(r.cqHead, head)
+
+	return nowUnix, ready
+}
@@ -0,0 +1,154 @@
+package poller
+
+import (
+	"syscall"
+	"time"
+
+	mdgoErr "github.com/aizsfgk/mdgo/net/errors"
+	"github.com/aizsfgk/mdgo/net/event"
+	"github.com/aizsfgk/mdgo/net/logger"
+)
+
+const (
+	pollIn   = 0x1
+	pollPri  = 0x2
+	pollOut  = 0x4
+	pollErr  = 0x8
+	pollHup  = 0x10
+	pollNval = 0x20
+
+	// 与 epoll 的事件划分保持一致
+	pollReadEvent  = pollIn | pollPri | pollRdHup
+	pollWriteEvent = pollOut
+)
+
+// struct pollfd
+type pollFd struct {
+	fd      int32
+	events  int16
+	revents int16
+}
+
+// 基于 poll(2) 的轮询器
+// 每次等待都传入全部 fd, 开销随 fd 数线性增长; 可移植, 也用于与 epoll 对照验证语义
+type poll struct {
+	fds    []pollFd         // 注册的 fd, 直接作为 poll 的参数
+	index  map[int]int      // fd -> fds 下标
+	ts     syscall.Timespec // ppoll 超时, 放在结构体中避免逃逸
+	logger logger.Logger
+}
+
+func newPoll(l logger.Logger) (*poll, error) {
+	l.Debugf("new poll poller")
+	return &poll{
+		fds:    make([]pollFd, 0, WaitEventsBegin),
+		index:  make(map[int]int, WaitEventsBegin),
+		logger: l,
+	}, nil
+}
+
+func (p *poll) Close() error {
+	p.fds, p.index = nil, nil
+	return nil
+}
+
+func (p *poll) Add(fd int, eve event.Event) error {
+	var events int16
+
+	if eve&event.EventRead != 0 {
+		events = pollReadEvent
+	} else if eve&event.EventWrite != 0 {
+		events = pollWriteEvent
+	} else {
+		return mdgoErr.EventIsNil
+	}
+
+	if _, ok := p.index[fd]; ok {
+		return syscall.EEXIST
+	}
+	p.index[fd] = len(p.fds)
+	p.fds = append(p.fds, pollFd{fd: int32(fd), events: events})
+	return nil
+}
+
+// 最后一个 fd 移到被删除的位置
+func (p *poll) Del(fd int) error {
+	i, ok := p.index[fd]
+	if !ok {
+		return syscall.ENOENT
+	}
+	last := len(p.fds) - 1
+	if i != last {
+		p.fds[i] = p.fds[last]
+		p.index[int(p.fds[i].fd)] = i
+	}
+	p.fds = p.fds[:last]
+	delete(p.index, fd)
+	return nil
+}
+
+func (p *poll) mod(fd int, events int16) error {
+	i, ok := p.index[fd]
+	if !ok {
+		return syscall.ENOENT
+	}
+	p.fds[i].events = events
+	return nil
+}
+
+func (p *poll) EnableRead(fd int) error {
+	return p.mod(fd, pollReadEvent)
+}
+
+func (p *poll) EnableWrite(fd int) error {
+	return p.mod(fd, pollWriteEvent)
+}
+
+func (p *poll) EnableReadWrite(fd int) error {
+	return p.mod(fd, pollReadEvent|pollWriteEvent)
+}
+
+func (p *poll) Poll(msec int, acp *[]event.EventHolder) (int64, int) {
+	n, err := p.wait(msec)
+	nowUnix := time.Now().Unix()
+
+	if err != nil {
+		if err == syscall.EAGAIN || err == syscall.EINTR {
+			return nowUnix, 0
+		}
+
+		p.logger.Errorf("poll: wait err: %v", err)
+		return nowUnix, 0
+	}
+
+	if len(*acp) < n {
+		*acp = make([]event.EventHolder, len(p.fds))
+	}
+
+	// n 为 revents 不为 0 的 fd 数
+	var evHolder event.EventHolder
+	ready := 0
+	for i := 0; i < len(p.fds) && ready < n; i++ {
+		revents := p.fds[i].revents
+		if revents == 0 {
+			continue
+		}
+		retEvent := event.EventNone
+		if revents&(pollErr|pollNval) != 0 {
+			retEvent |= event.EventError
+		}
+		if revents&pollReadEvent != 0 {
+			retEvent |= event.EventRead
+		}
+		if revents&(pollWriteEvent|pollHup) != 0 {
+			retEvent |= event.EventWrite
+		}
+		evHolder.Revent = retEvent
+		evHolder.Fd = int(p.fds[i].fd)
+
+		(*acp)[ready] = evHolder
+		ready++
+	}
+
+	return nowUnix, ready
+}
@@ -0,0 +1,23 @@
+// +build darwin netbsd freebsd openbsd dragonfly
+
+package poller
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const pollRdHup = 0 // 没有 POLLRDHUP, 对端关闭时读到 EOF
+
+func (p *poll) wait(msec int) (int, error) {
+	var fds unsafe.Pointer
+	if len(p.fds) > 0 {
+		fds = unsafe.Pointer(&p.fds[0])
+	}
+
+	n, _, errno := syscall.Syscall(syscall.SYS_POLL, uintptr(fds), uintptr(len(p.fds)), uintptr(msec))
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(n), nil
+}
@@ -0,0 +1,28 @@
+package poller
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const pollRdHup = 0x2000 // POLLRDHUP, since linux 2.6.17
+
+// 使用 ppoll, 部分架构(如 arm64)没有 poll 系统调用
+func (p *poll) wait(msec int) (int, error) {
+	var ts *syscall.Timespec
+	if msec >= 0 {
+		p.ts = syscall.NsecToTimespec(int64(msec) * int64(time.Millisecond))
+		ts = &p.ts
+	}
+	var fds unsafe.Pointer
+	if len(p.fds) > 0 {
+		fds = unsafe.Pointer(&p.fds[0])
+	}
+
+	n, _, errno := syscall.Syscall6(syscall.SYS_PPOLL, uintptr(fds), uintptr(len(p.fds)), uintptr(unsafe.Pointer(ts)), 0, 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(n), nil
+}
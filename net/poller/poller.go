@@ -1,7 +1,74 @@
+// 轮询器: epoll、poll 及 io_uring 的统一接口
+//
+// 本包可以在 linux 及 BSD/darwin 上编译, 非 linux 平台只有 poll 实现;
+// 但 net 包依赖 eventfd、timerfd、accept4、pipe2、splice 等 linux 系统调用, 目前只能在 linux 上使用
 package poller
 
-import _const "github.com/aizsfgk/mdgo/net/const"
+import (
+	"os"
+	"syscall"
+
+	_const "github.com/aizsfgk/mdgo/net/const"
+	"github.com/aizsfgk/mdgo/net/event"
+	"github.com/aizsfgk/mdgo/net/logger"
+)
 
 var (
 	WaitEventsBegin = _const.PollWaitEventsSize
 )
+
+// 轮询器名称
+const (
+	Epoll   = "epoll"    // epoll(7), 仅 linux
+	Poll    = "poll"     // poll(2), linux 下使用 ppoll
+	IOUring = "io_uring" // io_uring(7), 仅 linux, 内核不支持时使用 epoll
+)
+
+// 轮询器
+// 除 Poll 外的方法只在事件循环协程中调用(或事件循环启动之前), 无需加锁
+type Poller interface {
+	// 注册 fd, eve 为 EventRead 或 EventWrite
+	Add(fd int, eve event.Event) error
+	Del(fd int) error
+	EnableRead(fd int) error
+	EnableWrite(fd int) error
+	EnableReadWrite(fd int) error
+	// 等待至多 msec 毫秒, 就绪事件写入 *acp(空间不足时扩容), 返回当前时间戳及事件数
+	Poll(msec int, acp *[]event.EventHolder) (int64, int)
+	Close() error
+}
+
+// 可选: 支持边缘触发, 以边缘触发方式同时关注读写事件
+type EdgeTriggeredPoller interface {
+	AddEdgeTriggered(fd int) error
+}
+
+// 可选: 完成式 I/O(io_uring), 读、写及 accept 作为请求提交给内核, 完成后由 Poll 返回, 取代就绪通知
+// 以 AddCompletion 注册的 fd 通过以下方法提交请求, 同一 fd 的每种操作至多一个未完成;
+// 完成事件的 Op 为操作类型, 提交的请求在下一次 Poll 时与等待一起提交.
+// Del 立即取消 fd 上未完成的请求, 之后不再返回其完成事件, 调用者随后可以关闭 fd
+type CompletionPoller interface {
+	AddCompletion(fd int) error
+	// 接收数据, 数据放在轮询器的缓冲中, 完成事件的 Data 在下一次 Poll 之前有效
+	Recv(fd int) error
+	// 取消未完成的 Recv, 之后仍会返回其完成事件(可能已读到数据, 或 Res 为 -ECANCELED)
+	CancelRecv(fd int) error
+	// 发送 msg 描述的数据, 完成之前 msg 及其引用的数据不可修改
+	Sendmsg(fd int, msg *syscall.Msghdr) error
+	// 等待可写一次, 用于 sendfile 等不能提交的写
+	WaitWritable(fd int) error
+	// 接收一个连接, 新连接为非阻塞且设置了 close-on-exec
+	Accept(fd int) error
+}
+
+// 按名称创建轮询器
+// name 为空时使用环境变量 MDGO_POLLER, 仍为空则使用平台默认(linux 下为 epoll)
+func New(name string, l logger.Logger) (Poller, error) {
+	if len(name) == 0 {
+		name = os.Getenv("MDGO_POLLER")
+	}
+	if len(name) == 0 {
+		name = defaultPoller
+	}
+	return newPoller(name, l)
+}
@@ -0,0 +1,17 @@
+// +build darwin netbsd freebsd openbsd dragonfly
+
+package poller
+
+import (
+	mdgoErr "github.com/aizsfgk/mdgo/net/errors"
+	"github.com/aizsfgk/mdgo/net/logger"
+)
+
+const defaultPoller = Poll
+
+func newPoller(name string, l logger.Logger) (Poller, error) {
+	if name == Poll {
+		return newPoll(l)
+	}
+	return nil, mdgoErr.ErrUnknownPoller
+}
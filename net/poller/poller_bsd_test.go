@@ -2,5 +2,4 @@
 
 package poller
 
-type Poller struct {
-}
+var backends = []string{Poll}
@@ -0,0 +1,27 @@
+package poller
+
+import (
+	mdgoErr "github.com/aizsfgk/mdgo/net/errors"
+	"github.com/aizsfgk/mdgo/net/logger"
+)
+
+// 默认使用 epoll, io_uring 需通过名称或 MDGO_POLLER 选择
+const defaultPoller = Epoll
+
+func newPoller(name string, l logger.Logger) (Poller, error) {
+	switch name {
+	case Epoll:
+		return newEpoll(l)
+	case Poll:
+		return newPoll(l)
+	case IOUring:
+		// 内核不支持(早于 5.7, 或被 seccomp/io_uring_disabled 禁用)时使用 epoll
+		r, err := newIOUring(l)
+		if err != nil {
+			l.Warnf("io_uring unavailable: %v, fall back to epoll", err)
+			return newEpoll(l)
+		}
+		return r, nil
+	}
+	return nil, mdgoErr.ErrUnknownPoller
+}
@@ -0,0 +1,282 @@
+package poller
+
+import (
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/aizsfgk/mdgo/net/event"
+	"github.com/aizsfgk/mdgo/net/logger"
+)
+
+var backends = []string{Epoll, Poll, IOUring}
+
+func newCompletionPoller(t *testing.T) *uring {
+	r, err := newIOUring(logger.Nop)
+	if err != nil {
+		t.Skipf("io_uring unavailable: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	return r
+}
+
+// 等待 fd 上 op 的完成事件
+func waitOp(t *testing.T, p Poller, fd int, op event.Op) event.EventHolder {
+	t.Helper()
+	evs := make([]event.EventHolder, 1)
+	for i := 0; i < 10; i++ {
+		_, n := p.Poll(1000, &evs)
+		for j := 0; j < n; j++ {
+			if evs[j].Fd == fd && evs[j].Op == op {
+				return evs[j]
+			}
+			t.Fatalf("unexpected event fd %d op %d res %d", evs[j].Fd, evs[j].Op, evs[j].Res)
+		}
+	}
+	t.Fatalf("fd %d op %d is not completed", fd, op)
+	return event.EventHolder{}
+}
+
+func TestIOUringRecvSend(t *testing.T) {
+	r := newCompletionPoller(t)
+	fd, peer := newSocketPair(t)
+	if err := r.AddCompletion(fd); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Recv(fd); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Recv(fd); err != syscall.EALREADY {
+		t.Fatalf("second Recv: got %v, want EALREADY", err)
+	}
+	if _, err := syscall.Write(peer, []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if ev := waitOp(t, r, fd, event.OpRecv); ev.Res != 4 || string(ev.Data) != "ping" {
+		t.Fatalf("recv: res %d, data %q", ev.Res, ev.Data)
+	}
+
+	// 两段数据一次发出
+	parts := [][]byte{[]byte("po"), []byte("ng")}
+	iov := make([]syscall.Iovec, len(parts))
+	for i, p := range parts {
+		iov[i].Base = &p[0]
+		iov[i].SetLen(len(p))
+	}
+	msg := &syscall.Msghdr{Iov: &iov[0]}
+	*(*uintptr)(unsafe.Pointer(&msg.Iovlen)) = uintptr(len(iov)) // size_t
+	if err := r.Sendmsg(fd, msg); err != nil {
+		t.Fatal(err)
+	}
+	if ev := waitOp(t, r, fd, event.OpSend); ev.Res != 4 {
+		t.Fatalf("send: res %d", ev.Res)
+	}
+	var b [8]byte
+	if n, err := syscall.Read(peer, b[:]); err != nil || string(b[:n]) != "pong" {
+		t.Fatalf("peer read %q, %v", b[:n], err)
+	}
+
+	// 对端关闭: Res 为 0
+	if err := r.Recv(fd); err != nil {
+		t.Fatal(err)
+	}
+	_ = syscall.Shutdown(peer, syscall.SHUT_WR)
+	if ev := waitOp(t, r, fd, event.OpRecv); ev.Res != 0 {
+		t.Fatalf("recv EOF: res %d", ev.Res)
+	}
+}
+
+// 归还读缓冲的完成事件不结束等待: 一次 Poll 即返回之后到达的数据
+func TestIOUringPollAfterReplenish(t *testing.T) {
+	r := newCompletionPoller(t)
+	fd, peer := newSocketPair(t)
+	if err := r.AddCompletion(fd); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Recv(fd); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := syscall.Write(peer, []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	waitOp(t, r, fd, event.OpRecv)
+
+	// 下一次 Poll 归还上一轮占用的缓冲
+	if err := r.Recv(fd); err != nil {
+		t.Fatal(err)
+	}
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		time.Sleep(50 * time.Millisecond)
+		_, _ = syscall.Write(peer, []byte("second"))
+	}()
+	evs := make([]event.EventHolder, 1)
+	_, n := r.Poll(5000, &evs)
+	<-written
+	if n != 1 || evs[0].Op != event.OpRecv || string(evs[0].Data) != "second" {
+		t.Fatalf("got %d events", n)
+	}
+}
+
+// 取消的 Recv 返回 ECANCELED; Del 之后不再返回完成事件
+func TestIOUringCancel(t *testing.T) {
+	r := newCompletionPoller(t)
+	fd, peer := newSocketPair(t)
+	if err := r.AddCompletion(fd); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Recv(fd); err != nil {
+		t.Fatal(err)
+	}
+	if ev := waitFd(t, r, fd, 0); ev != event.EventNone {
+		t.Fatalf("idle socket: got %v", ev)
+	}
+	if err := r.CancelRecv(fd); err != nil {
+		t.Fatal(err)
+	}
+	if ev := waitOp(t, r, fd, event.OpRecv); ev.Res != -int(syscall.ECANCELED) {
+		t.Fatalf("canceled recv: res %d", ev.Res)
+	}
+
+	if err := r.Recv(fd); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Del(fd); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := syscall.Write(peer, []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	evs := make([]event.EventHolder, 1)
+	if _, n := r.Poll(100, &evs); n != 0 {
+		t.Fatalf("deleted fd: got %d events", n)
+	}
+	if r.inflight != 0 {
+		t.Fatalf("inflight %d after cancel", r.inflight)
+	}
+}
+
+// 监听 127.0.0.1 的随机端口
+func newTCPListener(t *testing.T) (int, syscall.Sockaddr) {
+	lfd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = syscall.Close(lfd) })
+	if err = syscall.Bind(lfd, &syscall.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = syscall.Listen(lfd, 8); err != nil {
+		t.Fatal(err)
+	}
+	sa, err := syscall.Getsockname(lfd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lfd, sa
+}
+
+// 阻塞连接 sa
+func dialTCP(t *testing.T, sa syscall.Sockaddr) int {
+	cfd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = syscall.Connect(cfd, sa); err != nil {
+		_ = syscall.Close(cfd)
+		t.Fatal(err)
+	}
+	return cfd
+}
+
+func TestIOUringAccept(t *testing.T) {
+	r := newCompletionPoller(t)
+	lfd, sa := newTCPListener(t)
+	if err := r.AddCompletion(lfd); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Accept(lfd); err != nil {
+		t.Fatal(err)
+	}
+	cfd := dialTCP(t, sa)
+	defer syscall.Close(cfd)
+
+	ev := waitOp(t, r, lfd, event.OpAccept)
+	if ev.Res < 0 {
+		t.Fatalf("accept: %v", syscall.Errno(-ev.Res))
+	}
+	defer syscall.Close(ev.Res)
+	flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(ev.Res), syscall.F_GETFL, 0)
+	if errno != 0 || flags&syscall.O_NONBLOCK == 0 {
+		t.Fatalf("accepted fd is blocking: flags %#x, %v", flags, errno)
+	}
+}
+
+// 删除监听套接字时已接收但未返回的连接被关闭
+func TestIOUringAcceptCanceled(t *testing.T) {
+	r := newCompletionPoller(t)
+	lfd, sa := newTCPListener(t)
+	cfd := dialTCP(t, sa)
+	defer syscall.Close(cfd)
+
+	// accept 与取消在 Del 中一起提交, 连接已在队列中, accept 先完成
+	if err := r.AddCompletion(lfd); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Accept(lfd); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Del(lfd); err != nil {
+		t.Fatal(err)
+	}
+	_ = r.Close()
+
+	// 对端读到 EOF
+	tv := syscall.Timeval{Sec: 1}
+	if err := syscall.SetsockoptTimeval(cfd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		t.Fatal(err)
+	}
+	var b [1]byte
+	if n, err := syscall.Read(cfd, b[:]); n != 0 || err != nil {
+		t.Fatalf("read: n %d, err %v, want EOF", n, err)
+	}
+}
+
+// 读缓冲用尽时 Recv 等待缓冲归还后重新提交
+func TestIOUringBufferStarved(t *testing.T) {
+	r := newCompletionPoller(t)
+	type pair struct{ fd, peer int }
+	pairs := make([]pair, recvBufCount+8)
+	for i := range pairs {
+		pairs[i].fd, pairs[i].peer = newSocketPair(t)
+		if err := r.AddCompletion(pairs[i].fd); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Recv(pairs[i].fd); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := syscall.Write(pairs[i].peer, []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := make(map[int]byte)
+	evs := make([]event.EventHolder, 1)
+	for i := 0; len(got) < len(pairs) && i < 100; i++ {
+		_, n := r.Poll(100, &evs)
+		for _, ev := range evs[:n] {
+			if ev.Op != event.OpRecv || ev.Res != 1 {
+				t.Fatalf("fd %d op %d res %d", ev.Fd, ev.Op, ev.Res)
+			}
+			got[ev.Fd] = ev.Data[0]
+		}
+	}
+	for i, p := range pairs {
+		if b, ok := got[p.fd]; !ok || b != byte(i) {
+			t.Fatalf("fd %d: got %d %v, want %d", p.fd, b, ok, i)
+		}
+	}
+}
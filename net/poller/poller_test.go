@@ -0,0 +1,139 @@
+package poller
+
+import (
+	"syscall"
+	"testing"
+
+	mdgoErr "github.com/aizsfgk/mdgo/net/errors"
+	"github.com/aizsfgk/mdgo/net/event"
+	"github.com/aizsfgk/mdgo/net/logger"
+)
+
+// SOCK_NONBLOCK 等仅 linux 支持, 创建后再设置, 以便在其他平台运行
+func newSocketPair(t *testing.T) (int, int) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fd := range fds {
+		syscall.CloseOnExec(fd)
+		if err = syscall.SetNonblock(fd, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		_ = syscall.Close(fds[0])
+		_ = syscall.Close(fds[1])
+	})
+	return fds[0], fds[1]
+}
+
+// 等待一次, 返回 fd 上的就绪事件
+func waitFd(t *testing.T, p Poller, fd int, msec int) event.Event {
+	evs := make([]event.EventHolder, 1)
+	_, n := p.Poll(msec, &evs)
+	var ret event.Event
+	for i := 0; i < n; i++ {
+		if evs[i].Fd == fd {
+			ret |= evs[i].Revent
+		} else {
+			t.Fatalf("unexpected fd %d", evs[i].Fd)
+		}
+	}
+	return ret
+}
+
+func TestPollerSemantics(t *testing.T) {
+	for _, name := range backends {
+		t.Run(name, func(t *testing.T) {
+			p, err := New(name, logger.Nop)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer p.Close()
+			fd, peer := newSocketPair(t)
+
+			if err = p.Add(fd, event.EventRead); err != nil {
+				t.Fatal(err)
+			}
+			if ev := waitFd(t, p, fd, 0); ev != event.EventNone {
+				t.Fatalf("idle socket: got %v", ev)
+			}
+
+			// 水平触发: 未读取时一直通知
+			_, _ = syscall.Write(peer, []byte("x"))
+			for i := 0; i < 2; i++ {
+				if ev := waitFd(t, p, fd, 1000); ev != event.EventRead {
+					t.Fatalf("readable socket: got %v", ev)
+				}
+			}
+			var b [1]byte
+			_, _ = syscall.Read(fd, b[:])
+
+			if err = p.EnableWrite(fd); err != nil {
+				t.Fatal(err)
+			}
+			if ev := waitFd(t, p, fd, 1000); ev != event.EventWrite {
+				t.Fatalf("writable socket: got %v", ev)
+			}
+			if err = p.EnableReadWrite(fd); err != nil {
+				t.Fatal(err)
+			}
+			_, _ = syscall.Write(peer, []byte("x"))
+			if ev := waitFd(t, p, fd, 1000); ev != event.EventRead|event.EventWrite {
+				t.Fatalf("readable and writable socket: got %v", ev)
+			}
+			_, _ = syscall.Read(fd, b[:])
+
+			// 对端关闭: 可读(读到 EOF)
+			if err = p.EnableRead(fd); err != nil {
+				t.Fatal(err)
+			}
+			_ = syscall.Shutdown(peer, syscall.SHUT_WR)
+			if ev := waitFd(t, p, fd, 1000); ev&event.EventRead == 0 {
+				t.Fatalf("peer shutdown: got %v", ev)
+			}
+
+			if err = p.Del(fd); err != nil {
+				t.Fatal(err)
+			}
+			if ev := waitFd(t, p, fd, 0); ev != event.EventNone {
+				t.Fatalf("deleted fd: got %v", ev)
+			}
+			if err = p.Del(fd); err != syscall.ENOENT {
+				t.Fatalf("delete again: got %v, want ENOENT", err)
+			}
+		})
+	}
+}
+
+// 就绪事件多于 acp 时扩容
+func TestPollerGrowEvents(t *testing.T) {
+	for _, name := range backends {
+		t.Run(name, func(t *testing.T) {
+			p, err := New(name, logger.Nop)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer p.Close()
+
+			const num = 8
+			for i := 0; i < num; i++ {
+				fd, _ := newSocketPair(t)
+				if err = p.Add(fd, event.EventWrite); err != nil {
+					t.Fatal(err)
+				}
+			}
+			evs := make([]event.EventHolder, 1)
+			if _, n := p.Poll(1000, &evs); n != num {
+				t.Fatalf("got %d events, want %d", n, num)
+			}
+		})
+	}
+}
+
+func TestPollerUnknown(t *testing.T) {
+	if _, err := New("select", logger.Nop); err != mdgoErr.ErrUnknownPoller {
+		t.Fatalf("got %v, want %v", err, mdgoErr.ErrUnknownPoller)
+	}
+}
@@ -0,0 +1,52 @@
+package net
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultRetryInitialDelay = 500 * time.Millisecond
+	defaultRetryMaxDelay     = 30 * time.Second
+)
+
+// 重连策略: 指数退避
+// 第 n 次重连的延迟为 InitialDelay * 2^(n-1), 不超过 MaxDelay
+// 再随机减少至多 Jitter 比例, 避免大量客户端同时重连
+type RetryPolicy struct {
+	InitialDelay time.Duration // 首次重连延迟, 0 表示 500ms
+	MaxDelay     time.Duration // 最大延迟, 0 表示 30s
+	Jitter       float64       // 随机抖动比例, 取值 [0, 1]
+	MaxAttempts  int           // 连续重连次数上限, 0 表示不限
+}
+
+// 第 attempt 次重连的延迟, attempt 从1开始
+func (p *RetryPolicy) delay(attempt int) time.Duration {
+	initial, max := p.InitialDelay, p.MaxDelay
+	if initial <= 0 {
+		initial = defaultRetryInitialDelay
+	}
+	if max <= 0 {
+		max = defaultRetryMaxDelay
+	}
+	if max < initial {
+		max = initial
+	}
+
+	d := initial
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+
+	if p.Jitter > 0 {
+		jitter := p.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		d -= time.Duration(float64(d) * jitter * rand.Float64())
+	}
+	return d
+}
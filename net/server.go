@@ -1,16 +1,22 @@
 package net
 
 import (
-	"fmt"
+	"context"
+	"net"
 	"runtime"
 	"strconv"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/aizsfgk/mdgo/base/atomic"
+	"github.com/aizsfgk/mdgo/net/buffer"
 	mdgoErr "github.com/aizsfgk/mdgo/net/errors"
 )
 
+// Shutdown 检查连接是否全部关闭的间隔
+const shutdownPollInterval = 10 * time.Millisecond
+
 // 处理句柄
 type Handler interface {
 	OnEventLoopInit(conn *Connection)
@@ -19,9 +25,11 @@ type Handler interface {
 }
 
 // 编解码器
+// Unpack 从输入缓冲中解出一个完整的帧, 并取走其占用的字节; 数据不足时返回 nil, nil, 剩余数据留在缓冲中
+// Pack 将消息编码为待发送的字节, 可能在多个协程中并发调用
 type Codec interface {
-	Pack(b []byte)
-	Unpack(b []byte) interface{}
+	Pack(msg interface{}) ([]byte, error)
+	Unpack(in *buffer.FixBuffer) (interface{}, error)
 }
 
 // 服务器
@@ -30,10 +38,13 @@ type Server struct {
 	option        *Option        // 配置选项
 	handler       Handler        // 回调句柄
 	codec         Codec          // 编解码器 ??? 是否可以放到 EventLoop 减少锁开销
+	listeners     []*Listener    // 监听器, reusePort 模式下每个 subReactor 一个
 	mainLoop      *EventLoop     // mainReactor
 	workLoops     []*EventLoop   // subReactor
 	nextLoopIndex int            // workLoop索引
+	connNum       atomic.Int64   // 当前连接数
 	wg            sync.WaitGroup // 同步
+	stopped       chan struct{}  // Start 释放资源后关闭
 }
 
 // 新建服务器
@@ -46,22 +57,29 @@ func NewServer(handler Handler, optionCbs ...OptionCallback) (serv *Server, err
 	// new server
 	serv = new(Server)
 	serv.handler = handler
+	serv.stopped = make(chan struct{})
 	serv.option = newOption(optionCbs...)
-	serv.mainLoop, err = NewEventLoop()
+	serv.codec = serv.option.Codec
+	if serv.codec != nil {
+		if _, ok := handler.(FrameCallback); !ok {
+			return nil, mdgoErr.ErrNoFrameCallback
+		}
+	}
+	serv.mainLoop, err = newEventLoop(serv.option)
 	if err != nil {
-		_ = serv.mainLoop.Stop
 		return nil, err
 	}
 	serv.mainLoop.LoopId = "mainReactor"
 
-	// new listener
-	listener, err := NewListener(serv.option.Network, serv.option.Addr, serv.option.ReusePort, serv.mainLoop, serv.handleNewConnection)
-	if err != nil {
-		return nil, err
-	}
-	if err = serv.mainLoop.AddSocketAndEnableRead(listener.Fd(), listener); err != nil {
-		return nil, err
-	}
+	// 之后出错时停止已创建的事件循环, 已注册的监听器随 Stop 关闭
+	loops := []*EventLoop{serv.mainLoop}
+	defer func() {
+		if err != nil {
+			for _, loop := range loops {
+				_ = loop.Stop()
+			}
+		}
+	}()
 
 	if serv.option.NumLoop > runtime.NumCPU() {
 		serv.option.NumLoop = runtime.NumCPU()
@@ -71,26 +89,55 @@ func NewServer(handler Handler, optionCbs ...OptionCallback) (serv *Server, err
 	if serv.option.NumLoop > 0 {
 		subLoops := make([]*EventLoop, serv.option.NumLoop)
 		for i := 0; i < serv.option.NumLoop; i++ {
-			loop, err := NewEventLoop()
-			loop.LoopId = "subReactor_idx_" + strconv.Itoa(i)
+			loop, err := newEventLoop(serv.option)
 			if err != nil {
-				fmt.Println("NewEventLoop sub err: ", err.Error())
-				for j := 0; j < i; j++ {
-					_ = subLoops[i].Stop()
-				}
+				serv.option.Logger.Errorf("new sub loop %d err: %v", i, err)
 				return nil, err
 			}
+			loop.LoopId = "subReactor_idx_" + strconv.Itoa(i)
 			subLoops[i] = loop
+			loops = append(loops, loop)
 		}
 		serv.workLoops = subLoops
 	}
 
+	// new listener
+	if serv.option.ReusePort && len(serv.workLoops) > 0 {
+		// 每个 subReactor 拥有自己的监听套接字, 连接直接在本循环处理, 不经过 mainReactor
+		addr := serv.option.Addr
+		for _, loop := range serv.workLoops {
+			listener, err := serv.newListener(addr, loop, serv.loopConnectionHandler(loop))
+			if err != nil {
+				return nil, err
+			}
+			// 端口为0时, 其余监听套接字绑定到第一个的实际端口
+			addr = listener.Addr().String()
+		}
+	} else {
+		if _, err = serv.newListener(serv.option.Addr, serv.mainLoop, serv.handleNewConnection); err != nil {
+			return nil, err
+		}
+	}
+
+	// idle timeout: 每个事件循环一个时间轮
+	if serv.option.IdleTimeout > 0 {
+		if len(serv.workLoops) == 0 {
+			serv.mainLoop.idleWheel = newTimingWheel(serv.mainLoop, serv.option.IdleTimeout)
+		}
+		for _, loop := range serv.workLoops {
+			loop.idleWheel = newTimingWheel(loop, serv.option.IdleTimeout)
+		}
+	}
+
 	return
 }
 
 // 启动服务器
+// 阻塞直到 Stop/Shutdown 使所有事件循环退出, 返回前关闭剩余的套接字
 func (serv *Server) Start() (err error) {
-	fmt.Println("Server Start ...")
+	defer close(serv.stopped)
+	serv.option.Logger.Infof("server start, addr: %s, loops: %d", serv.Addr(), serv.option.NumLoop)
+	serv.started.Set(true)
 
 	// subReactor Loop
 	for i := 0; i < serv.option.NumLoop; i++ {
@@ -109,25 +156,96 @@ func (serv *Server) Start() (err error) {
 	}()
 	serv.wg.Wait()
 
-	fmt.Println("Server Start End ...")
+	// 事件循环均已退出, 由当前协程接管并释放资源
+	for _, loop := range serv.loops() {
+		if err := loop.Stop(); err != nil {
+			serv.option.Logger.Errorf("loop %s stop err: %v", loop.LoopId, err)
+		}
+	}
+
+	serv.option.Logger.Infof("server stopped, addr: %s", serv.Addr())
 	return
 }
 
 // 停止服务器
+// 退出所有事件循环, 未发送的数据会丢弃; 需要发送完数据请使用 Shutdown
 func (serv *Server) Stop() {
-	if err := serv.mainLoop.Stop(); err != nil {
-		fmt.Println("mainLoop Stop err: ", err)
-		return
+	for _, loop := range serv.loops() {
+		loop.Quit()
 	}
 
-	for _, wlp := range serv.workLoops {
-		_ = wlp.Stop()
+	// 未启动, 直接释放资源
+	if !serv.started.Get() {
+		for _, loop := range serv.loops() {
+			_ = loop.Stop()
+		}
 	}
 	return
 }
 
+// 优雅关闭服务器
+// 1. 停止接收新连接
+// 2. 连接的输出缓冲发送完后关闭; 若设置了 WaitConnClose, 则等待业务或对端关闭连接
+// 3. ctx 到期时仍未关闭的连接会被强制关闭, 并返回 ctx.Err()
+// 4. 退出所有事件循环, 等待 Start 关闭剩余的套接字后返回; ctx 到期时不再等待
+func (serv *Server) Shutdown(ctx context.Context) (err error) {
+	for _, l := range serv.listeners {
+		l := l
+		l.loop.RunInLoop(func() {
+			if err := l.Close(); err != nil {
+				serv.option.Logger.Errorf("listener %s close err: %v", l.Addr(), err)
+			}
+		})
+	}
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for serv.connNum.Get() > 0 && err == nil {
+		// 每次检查前都重新投递, 覆盖停止监听前已接收但尚未注册的连接
+		if !serv.option.WaitConnClose {
+			serv.closeConnectionsAfterFlush()
+		}
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	// 剩余连接在事件循环退出后强制关闭
+	serv.Stop()
+	if serv.started.Get() {
+		select {
+		case <-serv.stopped:
+		case <-ctx.Done():
+			if err == nil {
+				err = ctx.Err()
+			}
+		}
+	}
+	return
+}
+
+// 监听地址
+func (serv *Server) Addr() net.Addr {
+	return serv.listeners[0].Addr()
+}
+
+// 处理连接的事件循环, Client 可以复用这些事件循环
+func (serv *Server) WorkLoops() []*EventLoop {
+	if len(serv.workLoops) == 0 {
+		return []*EventLoop{serv.mainLoop}
+	}
+	return serv.workLoops
+}
+
 // ******************** private method ******************** //
 
+// 所有事件循环
+func (serv *Server) loops() []*EventLoop {
+	return append([]*EventLoop{serv.mainLoop}, serv.workLoops...)
+}
+
 // 获取NextLoop
 func (serv *Server) nextEventLoop() *EventLoop {
 	if serv.option.NumLoop == 0 {
@@ -138,22 +256,87 @@ func (serv *Server) nextEventLoop() *EventLoop {
 	return loop
 }
 
+// 新建监听器, 并注册到 loop
+func (serv *Server) newListener(addr string, loop *EventLoop, handleConn HandlerConnFunc) (*Listener, error) {
+	listener, err := NewListener(serv.option.Network, addr, serv.option.ReusePort, loop, handleConn)
+	if err != nil {
+		return nil, err
+	}
+	if err = listener.register(); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	serv.listeners = append(serv.listeners, listener)
+	return listener, nil
+}
+
 // 新到连接处理
 func (serv *Server) handleNewConnection(fd int, sa syscall.Sockaddr) error {
+	return serv.newConnection(serv.nextEventLoop(), fd, sa)
+}
 
-	// get next eventLoop
-	loop := serv.nextEventLoop()
+// reusePort 模式下, 新连接留在 accept 所在的事件循环
+func (serv *Server) loopConnectionHandler(loop *EventLoop) HandlerConnFunc {
+	return func(fd int, sa syscall.Sockaddr) error {
+		return serv.newConnection(loop, fd, sa)
+	}
+}
+
+// 新建连接, 交给 loop 处理
+func (serv *Server) newConnection(loop *EventLoop, fd int, sa syscall.Sockaddr) error {
+	// socket options
+	if err := applySocketOptions(fd, serv.option); err != nil {
+		serv.option.Logger.Errorf("fd %d apply socket options err: %v", fd, err)
+		_ = syscall.Close(fd)
+		return err
+	}
 
 	// new connection
 	conn, err := NewConnection(fd, loop, sa, serv.handler)
 	if err != nil {
-		fmt.Println("NewConnection err: ", err.Error())
+		serv.option.Logger.Errorf("fd %d new connection err: %v", fd, err)
 		return err
 	}
 
-	// cb: OnConnection
-	serv.handler.OnConnection(conn)
+	conn.setCodec(serv.codec)
+	conn.setWaterMarks(serv.option.HighWaterMark, serv.option.LowWaterMark)
+	conn.edgeTriggered = serv.option.EdgeTriggered
+	conn.idleWheel = loop.idleWheel
+	conn.closeCb = serv.removeConnection
+	serv.connNum.Add(1)
+
+	// subReactor 的 socketCtx 只能在其自身协程中修改
+	loop.RunInLoop(func() {
+		// register event[Read]
+		// 先注册, OnConnection 中发送数据时才能激活写事件
+		if err := conn.register(); err != nil {
+			serv.option.Logger.Errorf("loop %s: fd %d register err: %v", loop.LoopId, fd, err)
+			_ = conn.handleClose()
+			return
+		}
+		if conn.idleWheel != nil {
+			conn.idleWheel.touch(conn)
+		}
+
+		// cb: OnConnection
+		serv.handler.OnConnection(conn)
+	})
+	return nil
+}
+
+// 各事件循环中的连接发送完数据后关闭
+func (serv *Server) closeConnectionsAfterFlush() {
+	for _, loop := range serv.loops() {
+		loop := loop
+		loop.RunInLoop(func() {
+			for _, conn := range loop.connections() {
+				conn.closeAfterFlush()
+			}
+		})
+	}
+}
 
-	// register event[Read]
-	return loop.AddSocketAndEnableRead(fd, conn)
+// 连接关闭
+func (serv *Server) removeConnection(conn *Connection) {
+	serv.connNum.Add(-1)
 }
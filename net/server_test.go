@@ -0,0 +1,366 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aizsfgk/mdgo/net/logger"
+	"github.com/aizsfgk/mdgo/net/poller"
+)
+
+func TestServerShutdownFlushOutput(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 512*1024) // 8MB
+
+	connected := make(chan struct{})
+	serv := startTestServer(t, &testHandler{
+		onConnection: func(conn *Connection) {
+			_ = conn.Send(payload)
+			close(connected)
+		},
+	})
+
+	cli, err := net.Dial("tcp", serv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	<-connected
+
+	// 客户端未读取, 大部分数据滞留在 OutBuf 中
+	shutdownErr := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		shutdownErr <- serv.Shutdown(ctx)
+	}()
+
+	_ = cli.SetReadDeadline(time.Now().Add(10 * time.Second))
+	got, err := ioutil.ReadAll(cli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Fatalf("got %d bytes, want %d", len(got), len(payload))
+	}
+
+	if err = <-shutdownErr; err != nil {
+		t.Fatalf("Shutdown err: %v", err)
+	}
+	// Shutdown 返回时 Start 已释放资源
+	select {
+	case <-serv.Server.stopped:
+	default:
+		t.Fatal("Shutdown returns before Start releases sockets")
+	}
+
+	// 已停止监听, 端口可以重新监听
+	if c, err := net.DialTimeout("tcp", serv.Addr().String(), time.Second); err == nil {
+		c.Close()
+		t.Fatal("server still accepts connections after Shutdown")
+	}
+	ln, err := net.Listen("tcp", serv.Addr().String())
+	if err != nil {
+		t.Fatalf("port is not released after Shutdown: %v", err)
+	}
+	ln.Close()
+}
+
+func TestServerShutdownDeadline(t *testing.T) {
+	closed := make(chan struct{}, 1)
+	serv := startTestServer(t, &testHandler{
+		onClose: func() { closed <- struct{}{} },
+	}, WaitConnClose(true))
+
+	cli, err := net.Dial("tcp", serv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	// 等待连接注册完成
+	for serv.connNum.Get() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err = serv.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Shutdown err: %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	select {
+	case <-serv.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start does not return after Shutdown")
+	}
+	select {
+	case <-closed:
+	default:
+		t.Fatal("connection is not force closed")
+	}
+
+	_ = cli.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var b [1]byte
+	if _, err = cli.Read(b[:]); err != io.EOF {
+		t.Fatalf("read err: %v, want EOF", err)
+	}
+}
+
+func TestServerShutdownWaitHandlerClose(t *testing.T) {
+	serv := startTestServer(t, &testHandler{
+		onMessage: func(conn *Connection, nowUnix int64) {
+			// 收到 bye 后由业务关闭连接
+			if conn.InBuf.RetrieveAllAsString() == "bye" {
+				_ = conn.Close()
+			}
+		},
+	}, WaitConnClose(true))
+
+	cli, err := net.Dial("tcp", serv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	for serv.connNum.Get() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- serv.Shutdown(context.Background())
+	}()
+
+	// 连接未关闭前 Shutdown 不返回
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("Shutdown returns before connection is closed: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if _, err = cli.Write([]byte("bye")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-shutdownErr:
+		if err != nil {
+			t.Fatalf("Shutdown err: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown does not return after connection is closed")
+	}
+}
+
+// 记录日志的 Logger
+type recordLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordLogger) record(level, format string, args []interface{}) {
+	l.mu.Lock()
+	l.lines = append(l.lines, level+" "+fmt.Sprintf(format, args...))
+	l.mu.Unlock()
+}
+
+func (l *recordLogger) Debugf(format string, args ...interface{}) { l.record("DEBUG", format, args) }
+func (l *recordLogger) Infof(format string, args ...interface{})  { l.record("INFO", format, args) }
+func (l *recordLogger) Warnf(format string, args ...interface{})  { l.record("WARN", format, args) }
+func (l *recordLogger) Errorf(format string, args ...interface{}) { l.record("ERROR", format, args) }
+
+func (l *recordLogger) contains(prefix string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range l.lines {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// 未设置 WithLogger 时不输出日志
+func TestDefaultLoggerNop(t *testing.T) {
+	if l := newOption().Logger; l != logger.Nop {
+		t.Fatalf("default logger %T, want logger.Nop", l)
+	}
+}
+
+func TestServerWithLogger(t *testing.T) {
+	rec := &recordLogger{}
+	serv, err := NewServer(&testHandler{}, Addr("127.0.0.1:0"), WithLogger(rec), WithPoller(poller.Epoll))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		_ = serv.Start()
+		close(done)
+	}()
+
+	cli, err := net.Dial("tcp", serv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for serv.connNum.Get() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	_ = cli.Close()
+	serv.Stop()
+	<-done
+
+	for _, prefix := range []string{
+		"DEBUG new epoll fd",
+		"DEBUG new listener fd",
+		"DEBUG listener fd",
+		"INFO server start",
+		"INFO server stopped",
+	} {
+		if !rec.contains(prefix) {
+			t.Errorf("missing log %q in %q", prefix, rec.lines)
+		}
+	}
+}
+
+// 每次建立并关闭一个连接的内存分配, 客户端直接使用系统调用, 尽量只统计服务端
+func BenchmarkServerAcceptClose(b *testing.B) {
+	closed := make(chan struct{}, 1)
+	serv, err := NewServer(&testHandler{
+		onClose: func() { closed <- struct{}{} },
+	}, Addr("127.0.0.1:0"), WithLogger(logger.Nop))
+	if err != nil {
+		b.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		_ = serv.Start()
+		close(done)
+	}()
+	defer func() {
+		serv.Stop()
+		<-done
+	}()
+
+	sa := &syscall.SockaddrInet4{Port: serv.Addr().(*net.TCPAddr).Port, Addr: [4]byte{127, 0, 0, 1}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err = syscall.Connect(fd, sa); err != nil {
+			b.Fatal(err)
+		}
+		_ = syscall.Close(fd)
+		<-closed
+	}
+}
+
+// 写 n 次 msg, 同时读回回显
+func echoRoundTrips(tb testing.TB, cli net.Conn, msg []byte, n int) {
+	go func() {
+		for i := 0; i < n; i++ {
+			if _, err := cli.Write(msg); err != nil {
+				return
+			}
+		}
+	}()
+	buf := make([]byte, len(msg))
+	for i := 0; i < n; i++ {
+		if _, err := io.ReadFull(cli, buf); err != nil {
+			tb.Fatal(err)
+		}
+		if !bytes.Equal(buf, msg) {
+			tb.Fatal("echo data mismatch")
+		}
+	}
+}
+
+func TestServerEchoTriggerModes(t *testing.T) {
+	msg := bytes.Repeat([]byte("0123456789abcdef"), 64*1024) // 1MB, 超过套接字缓冲区
+	for _, mode := range ioModes {
+		t.Run(mode.name, func(t *testing.T) {
+			serv := startEchoServer(t, mode.options()...)
+			cli, err := net.Dial("tcp", serv.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cli.Close()
+			_ = cli.SetDeadline(time.Now().Add(10 * time.Second))
+			echoRoundTrips(t, cli, msg, 8)
+		})
+	}
+}
+
+// 水平触发下部分写出时需要修改关注的写事件, 边缘触发下读写事件只注册一次; io_uring 下读写作为请求提交
+func BenchmarkServerEcho(b *testing.B) {
+	for _, mode := range ioModes {
+		for _, size := range []int{512, 256 * 1024} {
+			b.Run(fmt.Sprintf("%s/%d", mode.name, size), func(b *testing.B) {
+				serv := startEchoServer(b, append(mode.options(), WithLogger(logger.Nop))...)
+				cli, err := net.Dial("tcp", serv.Addr().String())
+				if err != nil {
+					b.Fatal(err)
+				}
+				defer cli.Close()
+
+				msg := bytes.Repeat([]byte("x"), size)
+				b.SetBytes(int64(size))
+				b.ResetTimer()
+				echoRoundTrips(b, cli, msg, b.N)
+			})
+		}
+	}
+}
+
+func TestServerEchoPollers(t *testing.T) {
+	msg := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	for _, name := range []string{poller.Epoll, poller.Poll, poller.IOUring} {
+		t.Run(name, func(t *testing.T) {
+			serv := startEchoServer(t, WithPoller(name), NumLoop(2))
+			cli, err := net.Dial("tcp", serv.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cli.Close()
+			_ = cli.SetDeadline(time.Now().Add(10 * time.Second))
+			echoRoundTrips(t, cli, msg, 8)
+		})
+	}
+}
+
+// 打开的 fd 数
+func openFds(t *testing.T) int {
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip(err)
+	}
+	return len(fds)
+}
+
+// 监听失败时释放已创建的事件循环
+func TestNewServerErrorCleanup(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	before := openFds(t)
+	for _, reusePort := range []bool{false, true} {
+		if _, err = NewServer(&testHandler{}, Addr(ln.Addr().String()), ReusePort(reusePort), NumLoop(1), WithLogger(logger.Nop)); err == nil {
+			t.Fatal("listen on a used address succeeds")
+		}
+	}
+	if after := openFds(t); after != before {
+		t.Fatalf("open fds %d, want %d", after, before)
+	}
+}
@@ -0,0 +1,109 @@
+package net
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// syscall 包中未定义的常量
+const (
+	soReusePort    = 0xf  // SO_REUSEPORT since linux 3.9
+	tcpUserTimeout = 0x12 // TCP_USER_TIMEOUT since linux 2.6.37
+)
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// 将 Option 中的套接字选项应用到已连接套接字
+func applySocketOptions(fd int, opt *Option) error {
+	if opt.NoDelay {
+		if err := setNoDelay(fd, true); err != nil {
+			return err
+		}
+	}
+	if opt.KeepAlive > 0 {
+		if err := setKeepAlive(fd, opt.KeepAlive); err != nil {
+			return err
+		}
+	}
+	if opt.RecvBuf > 0 {
+		if err := setRecvBuffer(fd, opt.RecvBuf); err != nil {
+			return err
+		}
+	}
+	if opt.SendBuf > 0 {
+		if err := setSendBuffer(fd, opt.SendBuf); err != nil {
+			return err
+		}
+	}
+	if opt.Linger >= 0 {
+		if err := setLinger(fd, opt.Linger); err != nil {
+			return err
+		}
+	}
+	if opt.UserTimeout > 0 {
+		if err := setUserTimeout(fd, opt.UserTimeout); err != nil {
+			return err
+		}
+	}
+	if opt.QuickAck {
+		if err := setQuickAck(fd, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 禁用 Nagle 算法
+func setNoDelay(fd int, noDelay bool) error {
+	return os.NewSyscallError("setsockopt", syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, syscall.TCP_NODELAY, boolToInt(noDelay)))
+}
+
+// 开启 TCP 保活, 空闲 d 后开始探测, 探测间隔也为 d; d <= 0 则关闭
+func setKeepAlive(fd int, d time.Duration) error {
+	if d <= 0 {
+		return os.NewSyscallError("setsockopt", syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE, 0))
+	}
+	if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE, 1); err != nil {
+		return os.NewSyscallError("setsockopt", err)
+	}
+	// 向上取整到秒
+	secs := int((d + time.Second - 1) / time.Second)
+	if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE, secs); err != nil {
+		return os.NewSyscallError("setsockopt", err)
+	}
+	return os.NewSyscallError("setsockopt", syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, secs))
+}
+
+func setRecvBuffer(fd int, bytes int) error {
+	return os.NewSyscallError("setsockopt", syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_RCVBUF, bytes))
+}
+
+func setSendBuffer(fd int, bytes int) error {
+	return os.NewSyscallError("setsockopt", syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_SNDBUF, bytes))
+}
+
+// sec < 0 关闭 linger; sec == 0 close 时直接发送 RST; sec > 0 close 最多阻塞 sec 秒
+func setLinger(fd int, sec int) error {
+	var l syscall.Linger
+	if sec >= 0 {
+		l.Onoff = 1
+		l.Linger = int32(sec)
+	}
+	return os.NewSyscallError("setsockopt", syscall.SetsockoptLinger(fd, syscall.SOL_SOCKET, syscall.SO_LINGER, &l))
+}
+
+// 已发送数据超过 d 仍未被确认, 则关闭连接
+func setUserTimeout(fd int, d time.Duration) error {
+	return os.NewSyscallError("setsockopt", syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, tcpUserTimeout, int(d/time.Millisecond)))
+}
+
+// 立即发送 ACK, 内核会在之后的某些时刻自动恢复为延迟确认
+func setQuickAck(fd int, quickAck bool) error {
+	return os.NewSyscallError("setsockopt", syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, syscall.TCP_QUICKACK, boolToInt(quickAck)))
+}
@@ -0,0 +1,70 @@
+package net
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func getsockoptInt(t *testing.T, fd, level, opt int) int {
+	v, err := syscall.GetsockoptInt(fd, level, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestServerApplySocketOptions(t *testing.T) {
+	connCh := make(chan *Connection, 1)
+	serv := startTestServer(t, &testHandler{
+		onConnection: func(conn *Connection) {
+			connCh <- conn
+		},
+	}, NoDelay(true), KeepAlive(30*time.Second), RecvBuf(64*1024), UserTimeout(5*time.Second), Linger(0))
+
+	cli, err := net.Dial("tcp", serv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	var conn *Connection
+	select {
+	case conn = <-connCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no connection")
+	}
+	fd := conn.Fd()
+
+	if v := getsockoptInt(t, fd, syscall.IPPROTO_TCP, syscall.TCP_NODELAY); v != 1 {
+		t.Errorf("TCP_NODELAY = %d", v)
+	}
+	if v := getsockoptInt(t, fd, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE); v != 1 {
+		t.Errorf("SO_KEEPALIVE = %d", v)
+	}
+	if v := getsockoptInt(t, fd, syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE); v != 30 {
+		t.Errorf("TCP_KEEPIDLE = %d", v)
+	}
+	// 内核会将 SO_RCVBUF 翻倍
+	if v := getsockoptInt(t, fd, syscall.SOL_SOCKET, syscall.SO_RCVBUF); v != 2*64*1024 {
+		t.Errorf("SO_RCVBUF = %d", v)
+	}
+	if v := getsockoptInt(t, fd, syscall.IPPROTO_TCP, tcpUserTimeout); v != 5000 {
+		t.Errorf("TCP_USER_TIMEOUT = %d", v)
+	}
+
+	// 运行时修改
+	if err = conn.SetNoDelay(false); err != nil {
+		t.Fatal(err)
+	}
+	if v := getsockoptInt(t, fd, syscall.IPPROTO_TCP, syscall.TCP_NODELAY); v != 0 {
+		t.Errorf("TCP_NODELAY = %d after SetNoDelay(false)", v)
+	}
+	if err = conn.SetKeepAlive(0); err != nil {
+		t.Fatal(err)
+	}
+	if v := getsockoptInt(t, fd, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE); v != 0 {
+		t.Errorf("SO_KEEPALIVE = %d after SetKeepAlive(0)", v)
+	}
+}
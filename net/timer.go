@@ -0,0 +1,158 @@
+package net
+
+import (
+	"container/heap"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/aizsfgk/mdgo/net/event"
+)
+
+const (
+	clockMonotonic = 1
+	tfdNonblock    = syscall.O_NONBLOCK
+	tfdCloexec     = syscall.O_CLOEXEC
+
+	minTimerDelay = 100 * time.Microsecond // timerfd 最小触发间隔
+)
+
+type itimerspec struct {
+	Interval syscall.Timespec
+	Value    syscall.Timespec
+}
+
+// 定时器
+type timer struct {
+	when     time.Time     // 到期时间
+	interval time.Duration // 大于0则重复执行
+	cb       func()        // 到期回调
+	index    int           // 在堆中的位置, -1 表示不在堆中
+	canceled bool          // 是否已取消
+}
+
+// 定时器标识, 用于取消定时器
+type TimerId struct {
+	t *timer
+}
+
+// 按到期时间排列的最小堆
+type timerHeap []*timer
+
+func (h timerHeap) Len() int           { return len(h) }
+func (h timerHeap) Less(i, j int) bool { return h[i].when.Before(h[j].when) }
+func (h timerHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *timerHeap) Push(x interface{}) {
+	t := x.(*timer)
+	t.index = len(*h)
+	*h = append(*h, t)
+}
+
+func (h *timerHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	t := old[n-1]
+	old[n-1] = nil
+	t.index = -1
+	*h = old[:n-1]
+	return t
+}
+
+// 定时器队列
+// 只使用一个 timerfd, 总是设置为堆顶定时器的到期时间
+// 所有操作都在事件循环协程中执行, 无需加锁
+type timerQueue struct {
+	fd      int
+	timers  timerHeap
+	expired []*timer // 复用, 避免每次分配
+	logger  Logger
+}
+
+func newTimerQueue(l Logger) (*timerQueue, error) {
+	r0, _, e := syscall.Syscall(syscall.SYS_TIMERFD_CREATE, clockMonotonic, tfdNonblock|tfdCloexec, 0)
+	if e != 0 {
+		return nil, e
+	}
+	return &timerQueue{fd: int(r0), logger: l}, nil
+}
+
+func (q *timerQueue) Fd() int {
+	return q.fd
+}
+
+func (q *timerQueue) addTimer(t *timer) {
+	if t.canceled {
+		return
+	}
+	heap.Push(&q.timers, t)
+	if t.index == 0 { // 最早到期, 需要重置 timerfd
+		q.resetTimerFd(t.when)
+	}
+}
+
+func (q *timerQueue) cancelTimer(t *timer) {
+	t.canceled = true
+	if t.index >= 0 {
+		heap.Remove(&q.timers, t.index)
+	}
+}
+
+// 设置 timerfd 的到期时间(相对时间)
+func (q *timerQueue) resetTimerFd(when time.Time) {
+	d := time.Until(when)
+	if d < minTimerDelay {
+		d = minTimerDelay
+	}
+	newValue := itimerspec{Value: syscall.NsecToTimespec(int64(d))}
+	_, _, e := syscall.Syscall6(syscall.SYS_TIMERFD_SETTIME, uintptr(q.fd), 0, uintptr(unsafe.Pointer(&newValue)), 0, 0, 0)
+	if e != 0 {
+		q.logger.Errorf("timerfd_settime fd %d err: %v", q.fd, e)
+	}
+}
+
+// timerfd 可读, 执行所有到期的定时器
+func (q *timerQueue) HandleEvent(eve event.Event, nowUnix int64) error {
+	if eve&event.EventRead == 0 {
+		return nil
+	}
+
+	var b [8]byte
+	if _, err := syscall.Read(q.fd, b[:]); err != nil && err != syscall.EAGAIN {
+		return err
+	}
+
+	now := time.Now()
+	for len(q.timers) > 0 && !q.timers[0].when.After(now) {
+		q.expired = append(q.expired, heap.Pop(&q.timers).(*timer))
+	}
+
+	for _, t := range q.expired {
+		// 可能被前面的回调取消
+		if !t.canceled {
+			t.cb()
+		}
+	}
+
+	for i, t := range q.expired {
+		if t.interval > 0 && !t.canceled {
+			t.when = now.Add(t.interval)
+			heap.Push(&q.timers, t)
+		}
+		q.expired[i] = nil
+	}
+	q.expired = q.expired[:0]
+
+	if len(q.timers) > 0 {
+		q.resetTimerFd(q.timers[0].when)
+	}
+	return nil
+}
+
+func (q *timerQueue) Close() error {
+	return syscall.Close(q.fd)
+}
@@ -0,0 +1,98 @@
+package net
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventLoopRunAfter(t *testing.T) {
+	loop, stop := startTestLoop(t)
+	defer stop()
+
+	fired := make(chan time.Time, 1)
+	begin := time.Now()
+	loop.RunAfter(50*time.Millisecond, func() {
+		if !loop.IsInLoop() {
+			t.Error("timer callback is not run in loop goroutine")
+		}
+		fired <- time.Now()
+	})
+
+	select {
+	case at := <-fired:
+		if cost := at.Sub(begin); cost < 50*time.Millisecond || cost > 500*time.Millisecond {
+			t.Fatalf("timer fired after %v", cost)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timer is not fired")
+	}
+}
+
+func TestEventLoopRunAtOrder(t *testing.T) {
+	loop, stop := startTestLoop(t)
+	defer stop()
+
+	now := time.Now()
+	got := make(chan int, 3)
+	loop.RunAt(now.Add(60*time.Millisecond), func() { got <- 3 })
+	loop.RunAt(now.Add(20*time.Millisecond), func() { got <- 1 })
+	loop.RunAt(now.Add(40*time.Millisecond), func() { got <- 2 })
+
+	for want := 1; want <= 3; want++ {
+		select {
+		case v := <-got:
+			if v != want {
+				t.Fatalf("got timer %d, want %d", v, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timer is not fired")
+		}
+	}
+}
+
+func TestEventLoopRunEveryAndCancel(t *testing.T) {
+	loop, stop := startTestLoop(t)
+	defer stop()
+
+	ticks := make(chan struct{}, 16)
+	id := loop.RunEvery(10*time.Millisecond, func() {
+		ticks <- struct{}{}
+	})
+	for i := 0; i < 3; i++ {
+		select {
+		case <-ticks:
+		case <-time.After(5 * time.Second):
+			t.Fatal("repeating timer is not fired")
+		}
+	}
+
+	loop.Cancel(id)
+	// 取消在事件循环中执行, 等待其完成后清空已触发的计数
+	synced := make(chan struct{})
+	loop.RunInLoop(func() { close(synced) })
+	<-synced
+	for len(ticks) > 0 {
+		<-ticks
+	}
+
+	select {
+	case <-ticks:
+		t.Fatal("timer fired after cancel")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestEventLoopCancelBeforeFire(t *testing.T) {
+	loop, stop := startTestLoop(t)
+	defer stop()
+
+	fired := make(chan struct{}, 1)
+	id := loop.RunAfter(20*time.Millisecond, func() { fired <- struct{}{} })
+	loop.Cancel(id)
+
+	select {
+	case <-fired:
+		t.Fatal("canceled timer fired")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,85 @@
+package net
+
+import (
+	"time"
+)
+
+const maxIdleTick = time.Second
+
+// 时间轮, 用于关闭空闲连接
+// 连接有活动时移入当前格子, 时间轮每转一格, 即将复用的格子中的连接都已超时
+// touch/remove/tick 都是 O(1), 适合大量连接; 所有操作在事件循环协程中执行
+type timingWheel struct {
+	tick    time.Duration              // 每格时长
+	buckets []map[*Connection]struct{} // 格子
+	spare   map[*Connection]struct{}   // 与到期格子交换, 避免遍历时修改
+	cur     int                        // 当前格子
+}
+
+func newTimingWheel(loop *EventLoop, timeout time.Duration) *timingWheel {
+	tick := timeout / 10
+	if tick > maxIdleTick {
+		tick = maxIdleTick
+	}
+	if tick <= 0 {
+		tick = timeout
+	}
+	// 连接停留满 n-1 格才会到期, 保证空闲时长不小于 timeout
+	n := int((timeout+tick-1)/tick) + 1
+
+	w := &timingWheel{
+		tick:    tick,
+		buckets: make([]map[*Connection]struct{}, n),
+	}
+	loop.RunEvery(tick, w.onTick)
+	return w
+}
+
+// 连接有活动, 移入当前格子
+func (w *timingWheel) touch(conn *Connection) {
+	if conn.wheelSlot == w.cur {
+		return
+	}
+	if conn.wheelSlot >= 0 {
+		delete(w.buckets[conn.wheelSlot], conn)
+	}
+	if w.buckets[w.cur] == nil {
+		w.buckets[w.cur] = make(map[*Connection]struct{})
+	}
+	w.buckets[w.cur][conn] = struct{}{}
+	conn.wheelSlot = w.cur
+}
+
+func (w *timingWheel) remove(conn *Connection) {
+	if conn.wheelSlot >= 0 {
+		delete(w.buckets[conn.wheelSlot], conn)
+		conn.wheelSlot = -1
+	}
+}
+
+// 转动一格, 处理到期的连接
+func (w *timingWheel) onTick() {
+	w.cur = (w.cur + 1) % len(w.buckets)
+
+	expired := w.buckets[w.cur]
+	if len(expired) == 0 {
+		return
+	}
+	if w.spare == nil {
+		w.spare = make(map[*Connection]struct{})
+	}
+	w.buckets[w.cur], w.spare = w.spare, expired
+
+	for conn := range expired {
+		delete(expired, conn)
+		conn.wheelSlot = -1
+		if !conn.connected.Get() {
+			continue
+		}
+		if ic, ok := conn.cb.(IdleCallback); ok && ic.OnIdle(conn) {
+			w.touch(conn) // 保留连接, 重新计时
+			continue
+		}
+		_ = conn.handleClose()
+	}
+}
@@ -0,0 +1,105 @@
+package net
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+type idleTestHandler struct {
+	testHandler
+	onIdle func(conn *Connection) bool
+}
+
+func (h *idleTestHandler) OnIdle(conn *Connection) bool {
+	return h.onIdle(conn)
+}
+
+func TestIdleTimeoutClose(t *testing.T) {
+	const timeout = 200 * time.Millisecond
+
+	idle := make(chan struct{}, 1)
+	serv := startTestServer(t, &idleTestHandler{
+		onIdle: func(conn *Connection) bool {
+			idle <- struct{}{}
+			return false
+		},
+	}, IdleTimeout(timeout))
+
+	cli, err := net.Dial("tcp", serv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	begin := time.Now()
+	_ = cli.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var b [1]byte
+	if _, err = cli.Read(b[:]); err != io.EOF {
+		t.Fatalf("read err: %v, want EOF", err)
+	}
+	if cost := time.Since(begin); cost < timeout {
+		t.Fatalf("closed after %v, before idle timeout", cost)
+	}
+	select {
+	case <-idle:
+	default:
+		t.Fatal("OnIdle is not called")
+	}
+}
+
+func TestIdleTimeoutKeepWithHeartbeat(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+
+	serv := startTestServer(t, &idleTestHandler{
+		onIdle: func(conn *Connection) bool {
+			_ = conn.SendString("ping\n")
+			return true
+		},
+	}, IdleTimeout(timeout))
+
+	cli, err := net.Dial("tcp", serv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	// 连接被保留, 持续收到心跳
+	_ = cli.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 15)
+	if _, err = io.ReadFull(cli, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "ping\nping\nping\n" {
+		t.Fatalf("got %q", buf)
+	}
+}
+
+func TestIdleTimeoutActiveConnection(t *testing.T) {
+	const timeout = 150 * time.Millisecond
+
+	closed := make(chan struct{}, 1)
+	serv := startTestServer(t, &testHandler{
+		onClose: func() { closed <- struct{}{} },
+	}, IdleTimeout(timeout))
+
+	cli, err := net.Dial("tcp", serv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	// 持续发送数据, 超过若干个 timeout 也不应被关闭
+	for i := 0; i < 10; i++ {
+		if _, err = cli.Write([]byte("x")); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(timeout / 3)
+	}
+	select {
+	case <-closed:
+		t.Fatal("active connection is closed")
+	default:
+	}
+}